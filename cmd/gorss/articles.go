@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Lallassu/gorss/internal"
+)
+
+// listArticles prints the articles matching the flags
+func listArticles(co *internal.Controller, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	unread := fs.Bool("unread", false, "Only unread articles")
+	starred := fs.Bool("starred", false, "Only starred articles")
+	feed := fs.String("feed", "", "Only articles of the feed with this URL, title or name")
+	tag := fs.String("tag", "", "Only articles with this tag")
+	since := fs.String("since", "", "Only articles published within this time, e.g. 24h or 7d")
+	format := fs.String("format", "text", "Output format: text, tsv or json")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		return fmt.Errorf("usage: gorss list [--unread] [--starred] [--feed feed] [--tag tag] [--since age] [--format text|tsv|json]")
+	}
+
+	filter := internal.ArticleFilter{Feed: *feed, Unread: *unread, Starred: *starred, Tag: *tag}
+	if *since != "" {
+		age, err := internal.ParseAge(*since)
+		if err != nil {
+			return err
+		}
+		filter.Since = time.Now().Add(-age)
+	}
+	articles := co.Articles(filter)
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(articles)
+	case "tsv":
+		for _, a := range articles {
+			fmt.Printf("%d\t%s\t%t\t%t\t%s\t%s\t%s\n", a.ID(), a.Published().Format(time.RFC3339),
+				a.Read(), a.Starred(), tsvField(a.Feed()), tsvField(a.Title()), tsvField(a.Link()))
+		}
+		return nil
+	case "text":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\t \tPUBLISHED\tFEED\tTITLE")
+		for _, a := range articles {
+			flags := ""
+			if !a.Read() {
+				flags += "N"
+			}
+			if a.Starred() {
+				flags += "*"
+			}
+			title := a.Title()
+			for _, t := range a.Tags() {
+				title += " #" + t
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", a.ID(), flags, a.Published().Local().Format("2006-01-02 15:04"), a.Feed(), title)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+}
+
+// showArticle prints an article with its content as text
+func showArticle(co *internal.Controller, args []string) error {
+	fs := flag.NewFlagSet("show", flag.ContinueOnError)
+	format := fs.String("format", "text", "Output format: text or json")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return fmt.Errorf("usage: gorss show <id> [--format text|json]")
+	}
+
+	a, err := articleArg(co, pos[0])
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(a)
+	case "text":
+		fmt.Printf("Title:     %s\n", a.Title())
+		fmt.Printf("Feed:      %s\n", a.Feed())
+		fmt.Printf("Published: %s\n", a.Published().Local().Format("2006-01-02 15:04"))
+		if len(a.Tags()) > 0 {
+			fmt.Printf("Tags:      %s\n", strings.Join(a.Tags(), ", "))
+		}
+		fmt.Printf("Link:      %s\n\n", a.Link())
+		content := a.FullContent()
+		if content == "" {
+			content = a.Content()
+		}
+		fmt.Println(internal.HTMLToText(content))
+		return nil
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+}
+
+// markRead marks articles as read, either by id or all articles of a feed,
+// with a tag and/or older than a given age.
+func markRead(co *internal.Controller, args []string) error {
+	fs := flag.NewFlagSet("mark-read", flag.ContinueOnError)
+	feed := fs.String("feed", "", "Mark the articles of the feed with this URL, title or name")
+	tag := fs.String("tag", "", "Mark the articles with this tag")
+	olderThan := fs.String("older-than", "", "Mark articles published before this time ago, e.g. 12h or 7d")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var articles []internal.Article
+	switch {
+	case len(pos) > 0 && (*feed != "" || *tag != "" || *olderThan != ""):
+		return fmt.Errorf("give either article ids or --feed/--tag/--older-than")
+	case len(pos) > 0:
+		for _, id := range pos {
+			a, err := articleArg(co, id)
+			if err != nil {
+				return err
+			}
+			articles = append(articles, *a)
+		}
+	case *feed != "" || *tag != "" || *olderThan != "":
+		filter := internal.ArticleFilter{Feed: *feed, Tag: *tag, Unread: true}
+		if *olderThan != "" {
+			age, err := internal.ParseAge(*olderThan)
+			if err != nil {
+				return err
+			}
+			filter.Before = time.Now().Add(-age)
+		}
+		articles = co.Articles(filter)
+	default:
+		return fmt.Errorf("usage: gorss mark-read <id...> | [--feed feed] [--tag tag] [--older-than age]")
+	}
+
+	n := co.MarkArticlesRead(articles)
+	fmt.Printf("Marked %d articles as read\n", n)
+	return nil
+}
+
+// openArticle opens the link of an article in the web browser and marks
+// the article as read.
+func openArticle(co *internal.Controller, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: gorss open <id>")
+	}
+
+	a, err := articleArg(co, args[0])
+	if err != nil {
+		return err
+	}
+	if a.Link() == "" {
+		return fmt.Errorf("article %d has no link", a.ID())
+	}
+
+	co.OpenLink(a.Link())
+	co.MarkArticlesRead([]internal.Article{*a})
+	return nil
+}
+
+// undoChanges undoes or redoes the last n changes of articles
+func undoChanges(co *internal.Controller, what string, args []string) error {
+	n := 1
+	if len(args) > 1 {
+		return fmt.Errorf("usage: gorss %s [n]", what)
+	}
+	if len(args) == 1 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return fmt.Errorf("invalid number of changes: %s", args[0])
+		}
+	}
+
+	undo, done := co.Undo, "Undid"
+	if what == "redo" {
+		undo, done = co.Redo, "Redid"
+	}
+	for i := 0; i < n; i++ {
+		description, err := undo()
+		if err != nil {
+			return err
+		}
+		if description == "" {
+			fmt.Printf("Nothing to %s\n", what)
+			break
+		}
+		fmt.Printf("%s: %s\n", done, description)
+	}
+	return nil
+}
+
+// articleArg returns the article of an id given on the command line
+func articleArg(co *internal.Controller, arg string) (*internal.Article, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid article id: %s", arg)
+	}
+	return co.Article(id)
+}
+
+// tsvField replaces the tabs and newlines of a value
+func tsvField(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Lallassu/gorss/internal"
+)
+
+// usage prints the flags and commands of gorss
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: gorss [flags] [command]\n\n")
+	fmt.Fprintf(out, "Without a command the reader is started.\n\n")
+	fmt.Fprintf(out, "Commands:\n")
+	fmt.Fprintf(out, "  daemon\t\tFetch feeds in the background until stopped\n")
+	fmt.Fprintf(out, "  export-opml [file]\tWrite all feeds as OPML to file (default stdout)\n")
+	fmt.Fprintf(out, "  feed add <url> [--name name] [--category category]\n")
+	fmt.Fprintf(out, "  feed list\n")
+	fmt.Fprintf(out, "  feed remove <url|name>\n")
+	fmt.Fprintf(out, "  feed rename <url|name> <new name>\n")
+	fmt.Fprintf(out, "  list [--unread] [--starred] [--feed feed] [--tag tag] [--since age] [--format text|tsv|json]\n")
+	fmt.Fprintf(out, "  show <id> [--format text|json]\n")
+	fmt.Fprintf(out, "  mark-read <id...> | [--feed feed] [--tag tag] [--older-than age]\n")
+	fmt.Fprintf(out, "  open <id>\t\tOpen the link of an article and mark it as read\n")
+	fmt.Fprintf(out, "  undo [n]\t\tUndo the last n changes of articles (read, unread, delete)\n")
+	fmt.Fprintf(out, "  redo [n]\t\tRedo the last n undone changes\n")
+	fmt.Fprintf(out, "  rules test [--feed feed] [--since age]\n\t\t\tShow what the rules would do with the stored articles\n")
+	fmt.Fprintf(out, "\nAges are durations such as 90m, 24h or 7d.\n")
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// runCommand runs a command given on the command line
+func runCommand(co *internal.Controller, cfg, db string, args []string) error {
+	switch args[0] {
+	case "daemon":
+		co.Setup(cfg, db)
+		return co.Daemon()
+	case "export-opml":
+		co.Setup(cfg, db)
+		return exportOPML(co, args[1:])
+	case "feed":
+		return feedCommand(co, cfg, db, args[1:])
+	case "list":
+		co.Setup(cfg, db)
+		return listArticles(co, args[1:])
+	case "show":
+		co.Setup(cfg, db)
+		return showArticle(co, args[1:])
+	case "mark-read":
+		co.Setup(cfg, db)
+		return markRead(co, args[1:])
+	case "open":
+		co.Setup(cfg, db)
+		return openArticle(co, args[1:])
+	case "rules":
+		co.Setup(cfg, db)
+		return rulesCommand(co, args[1:])
+	case "undo", "redo":
+		co.Setup(cfg, db)
+		return undoChanges(co, args[0], args[1:])
+	default:
+		usage()
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+// exportOPML writes all feeds as OPML to a file or stdout
+func exportOPML(co *internal.Controller, args []string) error {
+	if len(args) == 0 || args[0] == "-" {
+		return co.ExportOPML(os.Stdout)
+	}
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	if err := co.ExportOPML(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// feedCommand manages the feeds of the configuration file
+func feedCommand(co *internal.Controller, cfg, db string, args []string) error {
+	if len(args) == 0 {
+		usage()
+		return fmt.Errorf("missing feed command")
+	}
+
+	switch args[0] {
+	case "add":
+		fs := flag.NewFlagSet("feed add", flag.ContinueOnError)
+		name := fs.String("name", "", "Display name of the feed")
+		category := fs.String("category", "", "Category of the feed")
+		pos, err := parseArgs(fs, args[1:])
+		if err != nil {
+			return err
+		}
+		if len(pos) != 1 {
+			return fmt.Errorf("usage: gorss feed add <url> [--name name] [--category category]")
+		}
+
+		co.Setup(cfg, db)
+		f, title, err := co.AddFeed(internal.Feed{URL: pos[0], Name: *name, Category: *category})
+
+		// Let the user pick one if the web page has more than one feed
+		var derr *internal.DiscoveryError
+		if errors.As(err, &derr) && len(derr.Candidates) > 0 {
+			fmt.Printf("%s has more than one feed:\n", derr.URL)
+			for i, c := range derr.Candidates {
+				fmt.Printf("  [%d] %s\n", i+1, c)
+			}
+			fmt.Printf("Choose feed [1-%d]: ", len(derr.Candidates))
+
+			var n int
+			if _, err := fmt.Scanln(&n); err != nil || n < 1 || n > len(derr.Candidates) {
+				return fmt.Errorf("no feed chosen")
+			}
+			f, title, err = co.AddFeed(internal.Feed{URL: derr.Candidates[n-1], Name: *name, Category: *category})
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added %s (%s)\n", f.URL, title)
+
+	case "list":
+		co.Setup(cfg, db)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "URL\tNAME\tCATEGORY")
+		for _, f := range co.Feeds() {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", f.URL, f.Name, f.Category)
+		}
+		return w.Flush()
+
+	case "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: gorss feed remove <url|name>")
+		}
+		cf, err := internal.LoadConfigFile(cfg)
+		if err != nil {
+			return err
+		}
+		f, err := cf.RemoveFeed(args[1])
+		if err != nil {
+			return err
+		}
+		if err := cf.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s\n", f.URL)
+
+	case "rename":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: gorss feed rename <url|name> <new name>")
+		}
+		cf, err := internal.LoadConfigFile(cfg)
+		if err != nil {
+			return err
+		}
+		if err := cf.RenameFeed(args[1], args[2]); err != nil {
+			return err
+		}
+		if err := cf.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Renamed %s to %s\n", args[1], args[2])
+
+	default:
+		usage()
+		return fmt.Errorf("unknown feed command: %s", args[0])
+	}
+	return nil
+}
+
+// parseArgs parses flags that may be given before, after or between
+// positional arguments and returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return pos, nil
+		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
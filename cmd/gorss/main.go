@@ -22,10 +22,11 @@ func main() {
 
 	configFile := flag.String("config", defaultConfig, "Configuration file")
 	themeFile := flag.String("theme", defaultTheme, "Theme file")
-	logFile := flag.String("log", defaultLog, "Log file")
+	logFile := flag.String("log", defaultLog, "Log file, - for stderr")
 	dbFile := flag.String("db", defaultDB, "Database file")
 	versionFlag := flag.Bool("version", false, "Show version")
 
+	flag.Usage = usage
 	flag.Parse()
 
 	cfg := *configFile
@@ -110,13 +111,44 @@ func main() {
 	log.Printf("Using DB: %s\n", db)
 	log.Printf("Using log file: %s\n", *logFile)
 
-	if flog, err := os.Create(*logFile); err != nil {
-		log.Printf("Failed to create log file. Will log to stdout.")
+	if !internal.FullTextSearch() {
+		log.Printf("Warning: full-text search not available, search only matches titles. Build with -tags sqlite_fts5 (make does) to enable it.\n")
+	}
+
+	daemon := flag.Arg(0) == "daemon"
+
+	if *logFile == "-" {
+		log.SetOutput(os.Stderr)
 	} else {
-		log.SetOutput(flog)
+		// The reader starts a new log, the daemon and the other commands
+		// keep the log of earlier runs. They may run at the same time, e.g.
+		// gorss list from a status bar while the reader runs, so all of
+		// them append to not write over each other.
+		mode := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		if flag.NArg() == 0 {
+			mode |= os.O_TRUNC
+		}
+		if flog, err := os.OpenFile(*logFile, mode, 0600); err != nil {
+			log.Printf("Failed to open log file. Will log to stderr.")
+		} else {
+			log.SetOutput(flog)
+		}
+	}
+
+	if daemon {
+		log.SetFlags(0)
+		log.SetOutput(&internal.LogfmtWriter{W: log.Writer()})
 	}
 	co := &internal.Controller{}
 
-	co.Init(cfg, theme, db)
+	if flag.NArg() == 0 {
+		co.Init(cfg, theme, db)
+		return
+	}
+
+	if err := runCommand(co, cfg, db, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "gorss: %v\n", err)
+		os.Exit(1)
+	}
 
 }
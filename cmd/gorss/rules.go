@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Lallassu/gorss/internal"
+)
+
+// rulesCommand handles the rules subcommands
+func rulesCommand(co *internal.Controller, args []string) error {
+	if len(args) == 0 || args[0] != "test" {
+		usage()
+		return fmt.Errorf("usage: gorss rules test [--feed feed] [--since age]")
+	}
+	return testRules(co, args[1:])
+}
+
+// testRules prints the articles in the database that the rules match and
+// what the rules would do with them, without changing anything.
+func testRules(co *internal.Controller, args []string) error {
+	fs := flag.NewFlagSet("rules test", flag.ContinueOnError)
+	feed := fs.String("feed", "", "Only articles of the feed with this URL, title or name")
+	since := fs.String("since", "", "Only articles published within this time, e.g. 24h or 7d")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		return fmt.Errorf("usage: gorss rules test [--feed feed] [--since age]")
+	}
+
+	filter := internal.ArticleFilter{Feed: *feed}
+	if *since != "" {
+		age, err := internal.ParseAge(*since)
+		if err != nil {
+			return err
+		}
+		filter.Since = time.Now().Add(-age)
+	}
+	articles := co.Articles(filter)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tFEED\tTITLE\tRULE\tACTIONS")
+	matched := 0
+	for i := range articles {
+		a := &articles[i]
+		rules := co.MatchRules(a)
+		if len(rules) == 0 {
+			continue
+		}
+		matched++
+		for j, r := range rules {
+			if j == 0 {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", a.ID(), a.Feed(), truncate(a.Title(), 60), r, r.Actions())
+			} else {
+				fmt.Fprintf(w, "\t\t\t%s\t%s\n", r, r.Actions())
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d of %d articles match\n", matched, len(articles))
+	return nil
+}
+
+// truncate shortens a string to at most n characters
+func truncate(s string, n int) string {
+	r := []rune(strings.TrimSpace(s))
+	if len(r) <= n {
+		return string(r)
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,362 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FeedStats is a feed with its article counts and fetch status
+type FeedStats struct {
+	URL         string     `json:"url"`
+	Title       string     `json:"title"`
+	Name        string     `json:"name,omitempty"`
+	Category    string     `json:"category,omitempty"`
+	Unread      int        `json:"unread"`
+	Total       int        `json:"total"`
+	Failures    int        `json:"failures"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+}
+
+// articleChange is the body of a PATCH request for an article
+type articleChange struct {
+	Read    *bool `json:"read"`
+	Starred *bool `json:"starred"`
+}
+
+// StartAPI starts the HTTP API on apiListen, if set. The server is returned
+// so that it can be shut down. The JSON API requires apiToken if set, and is
+// only served on localhost without it. The Fever API has its own key.
+func (c *Controller) StartAPI() *http.Server {
+	if c.conf.APIListen == "" {
+		return nil
+	}
+
+	addr := c.conf.APIListen
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+
+	mux := http.NewServeMux()
+	if c.conf.APIToken != "" || loopback(addr) {
+		mux.Handle("/api/", c.apiAuth(c.apiMux()))
+	} else {
+		log.Printf("Not serving the JSON API on %s without apiToken", addr)
+	}
+	if c.conf.FeverAPIKey != "" {
+		mux.Handle("/fever/", c.FeverHandler())
+	}
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		log.Printf("Serving API on %s", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("API server failed: %v", err)
+		}
+	}()
+	return srv
+}
+
+// apiMux routes the requests of the JSON API
+func (c *Controller) apiMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/feeds", c.apiFeeds)
+	mux.HandleFunc("/api/articles", c.apiArticles)
+	mux.HandleFunc("/api/articles/", c.apiArticle)
+	mux.HandleFunc("/api/refresh", c.apiRefresh)
+	return mux
+}
+
+// apiAuth requires the bearer token apiToken, if set, for a handler
+func (c *Controller) apiAuth(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.conf.APIToken != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(c.conf.APIToken)) != 1 {
+				apiError(w, http.StatusUnauthorized, "invalid token")
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// loopback returns true if an address only listens on the local host
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// apiFeeds lists the feeds with their article counts
+func (c *Controller) apiFeeds(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	apiJSON(w, http.StatusOK, c.FeedStats())
+}
+
+// apiArticles lists the articles matching the query parameters feed,
+// unread, starred, tag, since and limit.
+func (c *Controller) apiArticles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+	filter := ArticleFilter{
+		Feed:    q.Get("feed"),
+		Unread:  apiBool(q.Get("unread")),
+		Starred: apiBool(q.Get("starred")),
+		Tag:     q.Get("tag"),
+	}
+	if since := q.Get("since"); since != "" {
+		if t, err := time.Parse(time.RFC3339, since); err == nil {
+			filter.Since = t
+		} else if age, err := ParseAge(since); err == nil {
+			filter.Since = time.Now().Add(-age)
+		} else {
+			apiError(w, http.StatusBadRequest, fmt.Sprintf("invalid since: %s", since))
+			return
+		}
+	}
+
+	articles := c.Articles(filter)
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			apiError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: %s", l))
+			return
+		}
+		if n < len(articles) {
+			articles = articles[:n]
+		}
+	}
+	apiJSON(w, http.StatusOK, articles)
+}
+
+// apiArticle gets or changes a single article
+func (c *Controller) apiArticle(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/articles/"))
+	if err != nil {
+		apiError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch, http.MethodPost:
+		var change articleChange
+		if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+			apiError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %v", err))
+			return
+		}
+		if change.Read != nil {
+			if err := c.SetArticleRead(id, *change.Read); err != nil {
+				apiError(w, http.StatusNotFound, err.Error())
+				return
+			}
+		}
+		if change.Starred != nil {
+			if err := c.SetArticleStarred(id, *change.Starred); err != nil {
+				apiError(w, http.StatusNotFound, err.Error())
+				return
+			}
+		}
+	default:
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	a, err := c.Article(id)
+	if err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	apiJSON(w, http.StatusOK, a)
+}
+
+// apiRefresh starts fetching all feeds
+func (c *Controller) apiRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !c.fetching() {
+		apiError(w, http.StatusConflict, fmt.Sprintf("feeds are fetched by process %d", lockPID(LockFile(c.dbFile))))
+		return
+	}
+
+	if !c.Refresh() {
+		apiError(w, http.StatusConflict, "feeds are already being refreshed")
+		return
+	}
+	apiJSON(w, http.StatusAccepted, map[string]int{"feeds": len(c.Feeds())})
+}
+
+// FeedStats returns all feeds with their article counts and fetch status
+func (c *Controller) FeedStats() []FeedStats {
+	unread := make(map[string]int)
+	total := make(map[string]int)
+	for _, a := range c.db.All() {
+		total[a.feed]++
+		if !a.read {
+			unread[a.feed]++
+		}
+	}
+
+	health := c.sched.Health()
+	stats := []FeedStats{}
+	for _, f := range c.Feeds() {
+		title := c.rss.Title(f.URL)
+		s := FeedStats{
+			URL:      f.URL,
+			Title:    title,
+			Name:     f.Name,
+			Category: f.Category,
+			Unread:   unread[title],
+			Total:    total[title],
+		}
+		if h, ok := health[f.URL]; ok {
+			s.Failures = h.Failures
+			s.LastError = h.LastError
+			if !h.LastSuccess.IsZero() {
+				t := h.LastSuccess
+				s.LastSuccess = &t
+			}
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// SetArticleRead marks an article as read or unread. The change is shown
+// right away if the reader is running.
+func (c *Controller) SetArticleRead(id int, read bool) error {
+	return c.changeArticle(id, func(a *Article) error {
+		if err := c.db.SetRead(a, read); err != nil {
+			return err
+		}
+		a.read = read
+		return nil
+	})
+}
+
+// SetArticleStarred stars or unstars an article. The change is shown right
+// away if the reader is running.
+func (c *Controller) SetArticleStarred(id int, starred bool) error {
+	return c.changeArticle(id, func(a *Article) error {
+		if err := c.db.SetStarred(a, starred); err != nil {
+			return err
+		}
+		a.starred = starred
+		return nil
+	})
+}
+
+// changeArticle applies a change to an article
+func (c *Controller) changeArticle(id int, change func(a *Article) error) error {
+	return c.changeArticles([]int{id}, func(articles []*Article) error {
+		for _, a := range articles {
+			if err := change(a); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// changeArticles applies a change to articles at once. With the reader
+// running the change is made on the UI goroutine to the articles that are
+// shown.
+func (c *Controller) changeArticles(ids []int, change func(articles []*Article) error) error {
+	apply := func() error {
+		loaded := make(map[int]*Article)
+		if c.win != nil {
+			for i := range c.articles {
+				loaded[c.articles[i].id] = &c.articles[i]
+			}
+		}
+
+		var articles []*Article
+		var missing []int
+		for _, id := range ids {
+			if a, ok := loaded[id]; ok {
+				articles = append(articles, a)
+			} else {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) > 0 {
+			// Not loaded yet, e.g. fetched by another process
+			stored := c.db.Articles(missing)
+			if len(stored) < len(missing) {
+				found := make(map[int]bool)
+				for _, a := range stored {
+					found[a.id] = true
+				}
+				for _, id := range missing {
+					if !found[id] {
+						return fmt.Errorf("no article with id %d", id)
+					}
+				}
+			}
+			for i := range stored {
+				stored[i].c = c
+				articles = append(articles, &stored[i])
+			}
+		}
+		return change(articles)
+	}
+
+	if c.win == nil {
+		return apply()
+	}
+
+	done := make(chan error, 1)
+	c.win.app.QueueUpdateDraw(func() {
+		err := apply()
+		if c.activeFeed != "unread" {
+			c.ShowArticles(c.activeFeed)
+		} else {
+			c.ShowFeeds()
+		}
+		done <- err
+	})
+	return <-done
+}
+
+// apiBool parses a boolean query parameter, a missing value is false
+func apiBool(v string) bool {
+	b, _ := strconv.ParseBool(v)
+	return b
+}
+
+// apiJSON writes a JSON response
+func apiJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write API response: %v", err)
+	}
+}
+
+// apiError writes an error as a JSON response
+func apiError(w http.ResponseWriter, status int, msg string) {
+	apiJSON(w, status, map[string]string{"error": msg})
+}
@@ -1,20 +1,122 @@
 package internal
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
 	"time"
+
+	"github.com/mmcdole/gofeed"
 )
 
 // Article holds the content of a feed item
 type Article struct {
 	c           *Controller
 	id          int
+	guid        string
 	feed        string
 	feedDisplay string
 	title       string
 	content     string
-	link        string
-	read        bool
-	deleted     bool
-	highlight   bool
-	published   time.Time
+	fullContent string
+	author      string
+	tags        []string
+	// color is the color of the title set by a rule
+	color     string
+	link      string
+	read      bool
+	starred   bool
+	deleted   bool
+	highlight bool
+	published time.Time
+}
+
+// ID returns the database id of the article
+func (a *Article) ID() int { return a.id }
+
+// Title returns the title of the article
+func (a *Article) Title() string { return a.title }
+
+// Content returns the content of the article, usually HTML
+func (a *Article) Content() string { return a.content }
+
+// FullContent returns the content extracted from the web page of the
+// article, or an empty string if it hasn't been fetched.
+func (a *Article) FullContent() string { return a.fullContent }
+
+// Author returns the author of the article, if given by the feed
+func (a *Article) Author() string { return a.author }
+
+// Tags returns the tags of the article, added by rules or the user
+func (a *Article) Tags() []string { return a.tags }
+
+// HasTag returns true if the article has a tag
+func (a *Article) HasTag(tag string) bool {
+	for _, t := range a.tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Link returns the link to the article on the website
+func (a *Article) Link() string { return a.link }
+
+// Feed returns the display name of the article's feed, or its title
+func (a *Article) Feed() string {
+	if a.feedDisplay != "" {
+		return a.feedDisplay
+	}
+	return a.feed
+}
+
+// Published returns the time the article was published
+func (a *Article) Published() time.Time { return a.published }
+
+// Read returns true if the article has been read
+func (a *Article) Read() bool { return a.read }
+
+// Starred returns true if the article is starred
+func (a *Article) Starred() bool { return a.starred }
+
+// MarshalJSON encodes the article for the command line commands
+func (a Article) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID          int       `json:"id"`
+		Feed        string    `json:"feed"`
+		Title       string    `json:"title"`
+		Author      string    `json:"author,omitempty"`
+		Link        string    `json:"link"`
+		Published   time.Time `json:"published"`
+		Read        bool      `json:"read"`
+		Starred     bool      `json:"starred"`
+		Highlight   bool      `json:"highlight"`
+		Tags        []string  `json:"tags,omitempty"`
+		Content     string    `json:"content"`
+		FullContent string    `json:"full_content,omitempty"`
+	}{a.id, a.Feed(), a.title, a.author, a.link, a.published, a.read, a.starred, a.highlight, a.tags, a.content, a.fullContent})
+}
+
+// ItemGUID returns a stable identity for a feed item. The item's own GUID
+// is used if present, otherwise its link or a hash of its content.
+func ItemGUID(item *gofeed.Item) string {
+	if item.GUID != "" {
+		return item.GUID
+	}
+	if item.Link != "" {
+		return item.Link
+	}
+	content := item.Description
+	if content == "" {
+		content = item.Content
+	}
+	return ContentHash(item.Title, content)
+}
+
+// ContentHash returns a hash of an article's title and content
+func ContentHash(title, content string) string {
+	h := sha1.Sum([]byte(title + "\n" + content))
+	return "sha1:" + hex.EncodeToString(h[:])
 }
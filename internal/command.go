@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"jaytaylor.com/html2text"
+)
+
+// Modes of custom commands
+const (
+	// commandWait shows that the command runs and then its result (the
+	// default). The reader is not blocked while it runs.
+	commandWait = "wait"
+	// commandBackground runs the command quietly, only a failure is shown
+	commandBackground = "background"
+	// commandSuspend suspends gorss while the command runs, for interactive
+	// programs such as less or w3m.
+	commandSuspend = "suspend"
+)
+
+// legacyVariable matches the ARTICLE.<Field> variables of older
+// configurations
+var legacyVariable = regexp.MustCompile(`ARTICLE\.(Title|Link|Feed|Content)`)
+
+// commandData holds the shell quoted article fields for command templates
+type commandData struct {
+	ID        string
+	Title     string
+	Link      string
+	Feed      string
+	Content   string
+	Text      string
+	Published string
+}
+
+// compile checks the command and parses its template
+func (cmd *Command) compile() error {
+	switch cmd.Mode {
+	case "", commandWait, commandBackground, commandSuspend:
+	default:
+		return fmt.Errorf("invalid mode %q", cmd.Mode)
+	}
+	switch cmd.Stdin {
+	case "", "content", "text", "json":
+	default:
+		return fmt.Errorf("invalid stdin %q", cmd.Stdin)
+	}
+
+	text, err := replaceLegacyVariables(cmd.Cmd)
+	if err != nil {
+		return err
+	}
+	t, err := template.New(cmd.Key).Parse(text)
+	if err != nil {
+		return err
+	}
+	cmd.tmpl = t
+	return nil
+}
+
+// replaceLegacyVariables replaces the ARTICLE.<Field> variables of older
+// configurations with the template fields. The fields are shell quoted, so
+// quotes around a variable are removed too. A variable within a longer quoted
+// string can't be quoted safely and is refused.
+func replaceLegacyVariables(s string) (string, error) {
+	// The quote that each byte is within, if any, and where it was opened
+	quotes := make([]byte, len(s))
+	opened := make([]int, len(s))
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		quotes[i], opened[i] = quote, start
+		switch ch := s[i]; {
+		case ch == '\\' && quote != '\'' && i+1 < len(s):
+			i++
+			quotes[i], opened[i] = quote, start
+		case quote == 0 && (ch == '\'' || ch == '"'):
+			quote, start = ch, i
+		case quote != 0 && ch == quote:
+			quote = 0
+		}
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range legacyVariable.FindAllStringSubmatchIndex(s, -1) {
+		from, to, field := m[0], m[1], s[m[2]:m[3]]
+		if q := quotes[from]; q != 0 {
+			if opened[from] != from-1 || to >= len(s) || s[to] != q {
+				if field == "Content" {
+					return "", fmt.Errorf("ARTICLE.Content within quotes can't be quoted safely, use {{.Content}} without quotes or \"stdin\": \"content\" instead")
+				}
+				return "", fmt.Errorf("ARTICLE.%s within quotes can't be quoted safely, use {{.%s}} without quotes or \"$GORSS_%s\" instead", field, field, strings.ToUpper(field))
+			}
+			from, to = from-1, to+1
+		}
+		b.WriteString(s[last:from])
+		b.WriteString("{{." + field + "}}")
+		last = to
+	}
+	b.WriteString(s[last:])
+	return b.String(), nil
+}
+
+// RunCommand runs a custom command for an article. The result is shown in
+// the status bar.
+func (c *Controller) RunCommand(cmd *Command, a *Article) {
+	text, err := html2text.FromString(a.content, html2text.Options{OmitLinks: true})
+	if err != nil {
+		text = a.content
+	}
+
+	published := a.published.Format(time.RFC3339)
+	data := commandData{
+		ID:        shellQuote(strconv.Itoa(a.id)),
+		Title:     shellQuote(a.title),
+		Link:      shellQuote(a.link),
+		Feed:      shellQuote(a.Feed()),
+		Content:   shellQuote(a.content),
+		Text:      shellQuote(text),
+		Published: shellQuote(published),
+	}
+	var script bytes.Buffer
+	if err := cmd.tmpl.Execute(&script, data); err != nil {
+		c.win.StatusMessage(fmt.Sprintf("Command %s failed: %v", cmd.Key, err))
+		return
+	}
+
+	command := exec.Command("/bin/sh", "-c", script.String())
+	command.Env = append(os.Environ(),
+		"GORSS_ID="+strconv.Itoa(a.id),
+		"GORSS_TITLE="+a.title,
+		"GORSS_LINK="+a.link,
+		"GORSS_FEED="+a.Feed(),
+		"GORSS_PUBLISHED="+published,
+	)
+
+	switch cmd.Stdin {
+	case "content":
+		command.Stdin = strings.NewReader(a.content)
+	case "text":
+		command.Stdin = strings.NewReader(text)
+	case "json":
+		if b, err := a.MarshalJSON(); err == nil {
+			command.Stdin = bytes.NewReader(b)
+		}
+	}
+
+	switch cmd.Mode {
+	case commandSuspend:
+		if command.Stdin == nil {
+			command.Stdin = os.Stdin
+		}
+		command.Stdout = os.Stdout
+		command.Stderr = os.Stderr
+		c.win.app.Suspend(func() {
+			err = command.Run()
+		})
+		c.win.StatusMessage(commandStatus(cmd.Key, nil, err))
+
+	default:
+		if cmd.Mode != commandBackground {
+			c.win.StatusMessage(fmt.Sprintf("Running command %s...", cmd.Key))
+		}
+		go func() {
+			out, err := command.CombinedOutput()
+			if err == nil && cmd.Mode == commandBackground {
+				return
+			}
+			c.win.app.QueueUpdateDraw(func() {
+				c.win.StatusMessage(commandStatus(cmd.Key, out, err))
+			})
+		}()
+	}
+}
+
+// commandStatus returns the last line of output of the command bound to a
+// key and its exit status for the status bar.
+func commandStatus(key string, out []byte, err error) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+
+	switch {
+	case err != nil && last != "":
+		return fmt.Sprintf("Command %s failed: %v: %s", key, err, last)
+	case err != nil:
+		return fmt.Sprintf("Command %s failed: %v", key, err)
+	case last != "":
+		return last
+	}
+	return fmt.Sprintf("Command %s done", key)
+}
+
+// shellQuote quotes a string for /bin/sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
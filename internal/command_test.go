@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReplaceLegacyVariables(t *testing.T) {
+	for _, tc := range []struct {
+		cmd, want string
+	}{
+		{"echo ARTICLE.Title", "echo {{.Title}}"},
+		{"echo 'ARTICLE.Title' \"ARTICLE.Link\"", "echo {{.Title}} {{.Link}}"},
+		{"echo 'ARTICLE.Content' 'ARTICLE.Link' > /tmp/test2.txt", "echo {{.Content}} {{.Link}} > /tmp/test2.txt"},
+		{`echo \"ARTICLE.Feed\"`, `echo \"{{.Feed}}\"`},
+		{"echo {{.Title}}", "echo {{.Title}}"},
+	} {
+		got, err := replaceLegacyVariables(tc.cmd)
+		if err != nil || got != tc.want {
+			t.Errorf("replaceLegacyVariables(%q) = %q, %v, want %q", tc.cmd, got, err, tc.want)
+		}
+	}
+
+	for _, cmd := range []string{
+		`echo "New: ARTICLE.Title"`,
+		`echo 'Title: ARTICLE.Title end'`,
+		`echo "ARTICLE.Title 'x'"`,
+		`echo "x 'ARTICLE.Link'"`,
+		`echo "ARTICLE.Feed\""`,
+	} {
+		if got, err := replaceLegacyVariables(cmd); err == nil {
+			t.Errorf("replaceLegacyVariables(%q) = %q, want an error", cmd, got)
+		} else if !strings.Contains(err.Error(), "{{.") {
+			t.Errorf("error %q doesn't tell what to use instead", err)
+		}
+	}
+}
+
+func TestCommandQuoting(t *testing.T) {
+	cmd := Command{Key: "x", Cmd: "echo 'ARTICLE.Title' {{.Link}}"}
+	if err := cmd.compile(); err != nil {
+		t.Fatal(err)
+	}
+	var script strings.Builder
+	data := commandData{Title: shellQuote("$(echo INJECTED) 'quoted'"), Link: shellQuote("a;b")}
+	if err := cmd.tmpl.Execute(&script, data); err != nil {
+		t.Fatal(err)
+	}
+	want := `echo '$(echo INJECTED) '\''quoted'\''' 'a;b'`
+	if script.String() != want {
+		t.Errorf("script %q, want %q", script.String(), want)
+	}
+}
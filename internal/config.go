@@ -6,14 +6,16 @@ import (
 	"os"
 	"reflect"
 	"strings"
+	"text/template"
 )
 
 // Config load the configuration from JSON file
 type Config struct {
-	Highlights                    []string      `json:"highlights"`
+	Highlights                    []Highlight   `json:"highlights"`
 	InputFeeds                    []interface{} `json:"feeds"`
 	Feeds                         []Feed        `json:"-"`
 	OPMLFile                      string        `json:"opmlFile"`
+	OPMLExportFile                string        `json:"opmlExportFile"`
 	FeedWindowSizeRatio           int           `json:"feedWindowSizeRatio"`
 	ArticleWindowSizeRatio        int           `json:"articleWindowSizeRatio"`
 	PreviewWindowSizeRatio        int           `json:"previewWindowSizeRatio"`
@@ -48,7 +50,17 @@ type Config struct {
 	KeySwitchWindows              string        `json:"keySwitchWindows"`
 	KeyQuit                       string        `json:"keyQuit"`
 	KeyUndoLastRead               string        `json:"keyUndoLastRead"`
+	KeyRedo                       string        `json:"keyRedo"`
 	KeySearchPromt                string        `json:"keySearchPromt"`
+	KeyToggleErrors               string        `json:"keyToggleErrors"`
+	KeyToggleStar                 string        `json:"keyToggleStar"`
+	KeyToggleCategory             string        `json:"keyToggleCategory"`
+	KeyExportOPML                 string        `json:"keyExportOPML"`
+	KeyAddFeed                    string        `json:"keyAddFeed"`
+	KeyFullContent                string        `json:"keyFullContent"`
+	KeyLinkPrompt                 string        `json:"keyLinkPrompt"`
+	KeySaveSearch                 string        `json:"keySaveSearch"`
+	KeyTag                        string        `json:"keyTag"`
 	// WebBrowser overrides the default program used to open links. Default one depends on the OS:
 	// * `xdg-open` for Linux
 	// * `url.dll,FileProtocolHandler` for Windows
@@ -56,19 +68,66 @@ type Config struct {
 	WebBrowser     string    `json:"webBrowser"`
 	CustomCommands []Command `json:"customCommands"`
 	Notifications  bool      `json:"notifications"`
+	// APIListen is the address of the HTTP API, e.g. localhost:8383. The
+	// API is disabled if not set, and listens on localhost if no host is
+	// given.
+	APIListen string `json:"apiListen"`
+	// APIToken is required as a bearer token by the JSON API if set. The
+	// JSON API is only served on other addresses than localhost if it is.
+	APIToken string `json:"apiToken"`
+	// FeverAPIKey enables the Fever API on /fever/ of the HTTP API. It is
+	// the md5 sum of "username:password".
+	FeverAPIKey string `json:"feverAPIKey"`
+	// GReader is a Google Reader compatible server, e.g. FreshRSS or
+	// Miniflux, to sync subscriptions and read/starred state with.
+	GReader GReaderConfig `json:"greader"`
+	// Hooks are run for new articles
+	Hooks []Hook `json:"hooks"`
+	// Rules change new articles before they are saved
+	Rules []Rule `json:"rules"`
+	// Searches are listed as feeds
+	Searches []SavedSearch `json:"searches"`
+}
+
+// GReaderConfig configures the sync with a Google Reader compatible server
+type GReaderConfig struct {
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Interval is the number of seconds between syncs, default
+	// SecondsBetweenUpdates.
+	Interval int `json:"interval"`
 }
 
 // Feed -
 type Feed struct {
 	URL  string
 	Name string
+	// Interval is the number of seconds between updates of this feed.
+	// If not set, SecondsBetweenUpdates or the feed's own hints are used.
+	Interval int
+	// Category groups feeds in the feeds window
+	Category string
+	// FetchFullContent downloads the web page of new articles and shows
+	// the article extracted from it instead of the content of the feed.
+	FetchFullContent bool
+	// Remote feeds are subscriptions on the sync server. Their articles
+	// are fetched from the server instead of from the feed.
+	Remote bool
 }
 
 // Command is used to parse a custom key->command from configuration file.
+// Cmd is a text/template run with /bin/sh, see RunCommand.
 type Command struct {
 	Key  string
 	Cmd  string
 	Args string
+	// Stdin is the article on stdin: content, text or json
+	Stdin string `json:"stdin"`
+	// Mode is wait (default), background or suspend
+	Mode string `json:"mode"`
+
+	tmpl *template.Template
 }
 
 // LoadConfiguration takes a filename (configuration) and loads it.
@@ -101,7 +160,19 @@ func LoadConfiguration(file string) Config {
 			if _, ok := v["name"]; ok {
 				name = v["name"].(string)
 			}
-			conf.Feeds[idx] = Feed{URL: url, Name: name}
+			interval := 0
+			if _, ok := v["interval"]; ok {
+				interval = int(v["interval"].(float64))
+			}
+			category := ""
+			if _, ok := v["category"]; ok {
+				category = v["category"].(string)
+			}
+			fullContent := false
+			if _, ok := v["fetchFullContent"]; ok {
+				fullContent = v["fetchFullContent"].(bool)
+			}
+			conf.Feeds[idx] = Feed{URL: url, Name: name, Interval: interval, Category: category, FetchFullContent: fullContent}
 		default:
 			log.Fatalf("unable to convert %v to a feed", v)
 		}
@@ -112,6 +183,10 @@ func LoadConfiguration(file string) Config {
 	val := reflect.Indirect(reflect.ValueOf(conf))
 	for i := 0; i < val.NumField(); i++ {
 		if strings.HasPrefix(val.Type().Field(i).Name, "Key") {
+			// Keys not set in the configuration are disabled
+			if val.Field(i).String() == "" {
+				continue
+			}
 			if _, ok := keys[val.Field(i).String()]; ok {
 				log.Fatal("Key defined more than once, key: ", val.Field(i).String())
 			} else {
@@ -120,13 +195,40 @@ func LoadConfiguration(file string) Config {
 		}
 	}
 
+	for _, s := range conf.Searches {
+		if strings.TrimSpace(s.Name) == "" || strings.TrimSpace(s.Query) == "" {
+			log.Fatal("Saved search needs a name and a query: ", s.Name)
+		}
+	}
+
+	for i := range conf.Highlights {
+		if err := conf.Highlights[i].compile(); err != nil {
+			log.Fatal("Invalid highlight ", conf.Highlights[i].String(), ": ", err)
+		}
+	}
+
+	for i := range conf.Rules {
+		if err := conf.Rules[i].compile(); err != nil {
+			log.Fatal("Invalid rule ", conf.Rules[i].String(), ": ", err)
+		}
+	}
+
+	for i := range conf.Hooks {
+		if err := conf.Hooks[i].compile(); err != nil {
+			log.Fatal("Invalid hook: ", err)
+		}
+	}
+
 	// Then check custom commands as well
-	for _, cmd := range conf.CustomCommands {
+	for i, cmd := range conf.CustomCommands {
 		if _, ok := keys[cmd.Key]; ok {
 			log.Fatal("Key defined more than once, key: ", cmd.Key)
 		} else {
 			keys[cmd.Key] = struct{}{}
 		}
+		if err := conf.CustomCommands[i].compile(); err != nil {
+			log.Fatal("Invalid custom command ", cmd.Key, ": ", err)
+		}
 	}
 
 	return conf
@@ -0,0 +1,273 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ConfigFile is used to change the feeds of a configuration file while
+// keeping all other settings, and their order, as they are.
+type ConfigFile struct {
+	path     string
+	keys     []string
+	values   map[string]json.RawMessage
+	feedsKey string
+	feeds    []json.RawMessage
+}
+
+// feedEntry is a feed as written to the configuration file
+type feedEntry struct {
+	URL              string `json:"url"`
+	Name             string `json:"name,omitempty"`
+	Category         string `json:"category,omitempty"`
+	Interval         int    `json:"interval,omitempty"`
+	FetchFullContent bool   `json:"fetchFullContent,omitempty"`
+}
+
+// LoadConfigFile reads a configuration file for editing
+func LoadConfigFile(path string) (*ConfigFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cf := &ConfigFile{path: path, values: make(map[string]json.RawMessage), feedsKey: "feeds"}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, fmt.Errorf("failed to parse config file %s: not a JSON object", path)
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+		}
+		key := t.(string)
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+		}
+		if _, ok := cf.values[key]; !ok {
+			cf.keys = append(cf.keys, key)
+		}
+		cf.values[key] = value
+		if strings.EqualFold(key, "feeds") {
+			cf.feedsKey = key
+		}
+	}
+
+	if raw, ok := cf.values[cf.feedsKey]; ok {
+		if err := json.Unmarshal(raw, &cf.feeds); err != nil {
+			return nil, fmt.Errorf("failed to parse feeds in %s: %v", path, err)
+		}
+	}
+	return cf, nil
+}
+
+// Feeds returns the feeds of the configuration file
+func (cf *ConfigFile) Feeds() []Feed {
+	feeds := make([]Feed, len(cf.feeds))
+	for i, raw := range cf.feeds {
+		feeds[i] = parseFeedEntry(raw).feed()
+	}
+	return feeds
+}
+
+// AddFeed adds a feed to the configuration file
+func (cf *ConfigFile) AddFeed(f Feed) error {
+	if f.URL == "" {
+		return fmt.Errorf("feed has no URL")
+	}
+	for _, e := range cf.Feeds() {
+		if e.URL == f.URL {
+			return fmt.Errorf("feed %s already exists", f.URL)
+		}
+	}
+
+	raw, err := json.Marshal(feedEntry{URL: f.URL, Name: f.Name, Category: f.Category, Interval: f.Interval, FetchFullContent: f.FetchFullContent})
+	if err != nil {
+		return err
+	}
+	cf.feeds = append(cf.feeds, raw)
+	return nil
+}
+
+// RemoveFeed removes the feed with the given URL or name
+func (cf *ConfigFile) RemoveFeed(id string) (Feed, error) {
+	i, err := cf.find(id)
+	if err != nil {
+		return Feed{}, err
+	}
+	f := cf.Feeds()[i]
+	cf.feeds = append(cf.feeds[:i], cf.feeds[i+1:]...)
+	return f, nil
+}
+
+// RenameFeed sets the display name of the feed with the given URL or name
+func (cf *ConfigFile) RenameFeed(id, name string) error {
+	i, err := cf.find(id)
+	if err != nil {
+		return err
+	}
+
+	e := parseFeedEntry(cf.feeds[i])
+	e.Name = name
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	cf.feeds[i] = raw
+	return nil
+}
+
+// find returns the index of the feed with the given URL or name
+func (cf *ConfigFile) find(id string) (int, error) {
+	found := -1
+	for i, f := range cf.Feeds() {
+		if f.URL == id || strings.EqualFold(f.Name, id) {
+			if found >= 0 {
+				return -1, fmt.Errorf("more than one feed matches %s, use the URL", id)
+			}
+			found = i
+		}
+	}
+	if found < 0 {
+		return -1, fmt.Errorf("no feed %s in %s", id, cf.path)
+	}
+	return found, nil
+}
+
+// Set sets a top-level value of the configuration file
+func (cf *ConfigFile) Set(key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	for _, k := range cf.keys {
+		if strings.EqualFold(k, key) {
+			key = k
+		}
+	}
+	if _, ok := cf.values[key]; !ok {
+		cf.keys = append(cf.keys, key)
+	}
+	cf.values[key] = raw
+	return nil
+}
+
+// Save writes the configuration file back with the changed feeds
+func (cf *ConfigFile) Save() error {
+	feeds, err := json.Marshal(cf.feeds)
+	if err != nil {
+		return err
+	}
+	if _, ok := cf.values[cf.feedsKey]; !ok {
+		cf.keys = append(cf.keys, cf.feedsKey)
+	}
+	cf.values[cf.feedsKey] = feeds
+
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, k := range cf.keys {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		key, _ := json.Marshal(k)
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(cf.values[k])
+	}
+	buf.WriteString("}")
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "    "); err != nil {
+		return err
+	}
+	out.WriteString("\n")
+
+	// Write to a temporary file first so that a failure doesn't leave
+	// a broken configuration behind.
+	mode := os.FileMode(0600)
+	if fi, err := os.Stat(cf.path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	tmp := cf.path + ".tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cf.path)
+}
+
+// parseFeedEntry parses a feed of the configuration file, which is either
+// a URL (old style) or an object.
+func parseFeedEntry(raw json.RawMessage) feedEntry {
+	var e feedEntry
+	var url string
+	if err := json.Unmarshal(raw, &url); err == nil {
+		e.URL = url
+		return e
+	}
+	json.Unmarshal(raw, &e)
+	return e
+}
+
+func (e feedEntry) feed() Feed {
+	return Feed{URL: e.URL, Name: e.Name, Category: e.Category, Interval: e.Interval, FetchFullContent: e.FetchFullContent}
+}
+
+// AddFeed validates a feed by fetching and parsing it and then adds it to
+// the configuration file. If the URL is a web page with a single feed that
+// feed is added instead, if it has more than one feed a *DiscoveryError
+// with the candidates is returned. The added feed is returned.
+func (c *Controller) AddFeed(f Feed) (Feed, string, error) {
+	cf, err := LoadConfigFile(c.confFile)
+	if err != nil {
+		return f, "", err
+	}
+
+	feed, candidates, err := c.rss.Discover(f.URL)
+	if err != nil {
+		return f, "", fmt.Errorf("%s is not a valid feed: %v", f.URL, err)
+	}
+	if feed == nil {
+		if len(candidates) != 1 {
+			return f, "", &DiscoveryError{URL: f.URL, Candidates: candidates}
+		}
+
+		f.URL = candidates[0]
+		if feed, err = c.rss.ParseURL(f.URL); err != nil {
+			return f, "", fmt.Errorf("%s is not a valid feed: %v", f.URL, err)
+		}
+	}
+
+	if err := cf.AddFeed(f); err != nil {
+		return f, "", err
+	}
+	if err := cf.Save(); err != nil {
+		return f, "", err
+	}
+
+	c.fLock.Lock()
+	c.conf.Feeds = append(c.conf.Feeds, f)
+	c.fLock.Unlock()
+	return f, feed.Title, nil
+}
+
+// Feeds returns a copy of all feeds, from both the configuration and the
+// OPML file.
+func (c *Controller) Feeds() []Feed {
+	c.fLock.RLock()
+	defer c.fLock.RUnlock()
+	return append([]Feed{}, c.conf.Feeds...)
+}
+
+// setFeeds replaces all feeds
+func (c *Controller) setFeeds(feeds []Feed) {
+	c.fLock.Lock()
+	defer c.fLock.Unlock()
+	c.conf.Feeds = feeds
+}
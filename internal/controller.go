@@ -1,15 +1,18 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
@@ -19,55 +22,102 @@ import (
 
 // Controller handles the logic and keep everything together
 type Controller struct {
-	rss           *RSS
-	db            *DB
-	win           *Window
-	activeFeed    string
-	linksToOpen   []string
-	quit          chan int
-	articles      []Article
-	aLock         sync.Mutex
-	conf          Config
-	theme         Theme
-	isUpdated     bool
-	prevArticle   *Article
-	undoArticle   *Article
-	lastUpdate    time.Time
-	searchResults int
+	confFile     string
+	dbFile       string
+	lock         *Lock
+	lockMu       sync.Mutex
+	latestID     int
+	rss          *RSS
+	sched        *Scheduler
+	db           *DB
+	win          *Window
+	activeFeed   string
+	linksToOpen  []string
+	quit         chan int
+	articles     []Article
+	aLock        sync.Mutex
+	uLock        sync.Mutex
+	sLock        sync.Mutex
+	conf         Config
+	theme        Theme
+	isUpdated    bool
+	prevArticle  *Article
+	lastUpdate   time.Time
+	searchHits   []SearchHit
+	searchTitles map[int]string
+	// savedSearches holds the hits of the saved searches by name
+	savedSearches map[string]*searchResult
+	// searchLock guards the search results, which are updated by the
+	// feed updates while the window shows them.
+	searchLock  sync.Mutex
+	collapsed   map[string]bool
+	greader     *GReader
+	nextSync    time.Time
+	remoteFeeds []Feed
+	lastCleanup time.Time
+	cLock       sync.Mutex
+	refreshing  atomic.Bool
+	// fLock guards conf.Feeds, which is changed while the feeds are
+	// updated, see Feeds.
+	fLock sync.RWMutex
+	// rLock guards nextSync and remoteFeeds, unlike sLock it isn't held
+	// while syncing.
+	rLock sync.Mutex
 }
 
+// categoryPrefix is used for the feed name of a category in the feeds window
+const categoryPrefix = "category:"
+
 // Init initiates the controller with database handles etc.
 // It also starts the update loop and window handling.
 func (c *Controller) Init(cfg, theme, db string) {
-	c.quit = make(chan int)
-
-	c.conf = LoadConfiguration(cfg)
+	c.Setup(cfg, db)
 	c.theme = LoadTheme(theme)
 
-	c.articles = make([]Article, 0)
-
-	c.db = &DB{}
-	if err := c.db.Init(c, db); err != nil {
-		log.Fatal("Database init failed.")
-	}
-
 	c.win = &Window{}
 	c.win.Init(c.Input, c)
 
-	c.rss = &RSS{}
-	c.rss.Init(c)
-
 	c.win.RegisterSelectedFunc(c.SelectArticle)
 	c.win.RegisterSelectionChangedFunc(c.SelectArticle)
 	c.win.RegisterSelectedFeedFunc(c.SelectFeed)
 
-	c.db.CleanupDB()
+	c.cleanupIfDue()
+
+	if !c.fetching() {
+		log.Printf("Feeds are fetched by another process (%s)", LockFile(c.dbFile))
+	}
+	c.StartAPI()
 
 	c.UpdateLoop()
 
 	c.win.Start()
 }
 
+// Setup loads the configuration and initiates the database and feeds
+// without any window, as used by the command line commands.
+func (c *Controller) Setup(cfg, db string) {
+	c.quit = make(chan int)
+
+	c.confFile = cfg
+	c.dbFile = db
+	c.conf = LoadConfiguration(cfg)
+
+	c.articles = make([]Article, 0)
+	c.collapsed = make(map[string]bool)
+
+	c.db = &DB{}
+	if err := c.db.Init(c, db); err != nil {
+		fmt.Fprintf(os.Stderr, "Database init failed: %v\n", err)
+		log.Fatal("Database init failed: ", err)
+	}
+
+	c.rss = &RSS{}
+	c.rss.Init(c)
+
+	c.sched = &Scheduler{}
+	c.sched.Init(c)
+}
+
 // GetConfigKeys creates a list of keys that we want to present
 // in the help section.
 func (c *Controller) GetConfigKeys() map[string]string {
@@ -91,10 +141,20 @@ func (c *Controller) GetConfigKeys() map[string]string {
 	keys["Select Article Window"] = c.conf.KeySelectArticleWindow
 	keys["Select Preview Window"] = c.conf.KeySelectPreviewWindow
 	keys["Update Feeds"] = c.conf.KeyUpdateFeeds
-	keys["Undo Last Read"] = c.conf.KeyUndoLastRead
+	keys["Undo"] = c.conf.KeyUndoLastRead
+	keys["Redo"] = c.conf.KeyRedo
 	keys["Switch Windows"] = c.conf.KeySwitchWindows
 	keys["Quit"] = c.conf.KeyQuit
 	keys["Search"] = c.conf.KeySearchPromt
+	keys["Toggle Feed Errors"] = c.conf.KeyToggleErrors
+	keys["Toggle Star"] = c.conf.KeyToggleStar
+	keys["Expand/Collapse Category"] = c.conf.KeyToggleCategory
+	keys["Export OPML"] = c.conf.KeyExportOPML
+	keys["Add Feed"] = c.conf.KeyAddFeed
+	keys["Fetch Full Content"] = c.conf.KeyFullContent
+	keys["Open/Mark/Copy Link in Preview"] = c.conf.KeyLinkPrompt
+	keys["Save Search"] = c.conf.KeySaveSearch
+	keys["Tag Article"] = c.conf.KeyTag
 
 	for _, cmd := range c.conf.CustomCommands {
 		keys[cmd.Cmd] = cmd.Key
@@ -103,14 +163,33 @@ func (c *Controller) GetConfigKeys() map[string]string {
 	return keys
 }
 
+// cleanupIfDue cleans up the database, at most once per
+// SecondsBetweenUpdates since feeds are updated on their own schedules.
+func (c *Controller) cleanupIfDue() {
+	c.cLock.Lock()
+	if time.Since(c.lastCleanup) < time.Duration(c.conf.SecondsBetweenUpdates)*time.Second {
+		c.cLock.Unlock()
+		return
+	}
+	c.lastCleanup = time.Now()
+	c.cLock.Unlock()
+
+	c.db.CleanupDB()
+}
+
 // UpdateLoop updates the feeds and windows
 func (c *Controller) UpdateLoop() {
 	c.GetArticlesFromDB()
-	go c.UpdateFeeds() // Start by updating feeds.
+	c.runSavedSearches()
+	c.latestID = c.db.LatestID()
+	if c.fetching() {
+		go c.UpdateSomeFeeds(c.sched.Due(time.Now())) // Start by updating feeds.
+		go c.syncIfDue()
+	}
 	c.ShowFeeds()
 	go func() {
 		updateWin := time.NewTicker(time.Duration(30) * time.Second)
-		updateFeeds := time.NewTicker(time.Duration(c.conf.SecondsBetweenUpdates) * time.Second)
+		updateFeeds := time.NewTicker(time.Duration(5) * time.Second)
 		for {
 			select {
 			case <-updateWin.C:
@@ -120,9 +199,28 @@ func (c *Controller) UpdateLoop() {
 				}
 				c.ShowFeeds()
 			case <-updateFeeds.C:
+				if !c.fetching() {
+					// Another gorss fetches the feeds, show what it has added.
+					if id := c.db.LatestID(); id != c.latestID {
+						c.latestID = id
+						c.lastUpdate = time.Now()
+						c.win.app.QueueUpdateDraw(func() {
+							c.showUpdates()
+							c.win.StatusUpdate()
+						})
+					}
+					continue
+				}
+				go c.syncIfDue()
+
+				// Each feed is fetched on its own schedule, see Scheduler.
+				due := c.sched.Due(time.Now())
+				if len(due) == 0 {
+					continue
+				}
 				go func() {
-					c.UpdateFeeds()
-					c.db.CleanupDB()
+					c.UpdateSomeFeeds(due)
+					c.cleanupIfDue()
 					c.win.StatusUpdate()
 				}()
 			case <-c.quit:
@@ -135,14 +233,66 @@ func (c *Controller) UpdateLoop() {
 
 // Quit ends the application
 func (c *Controller) Quit() {
+	c.releaseLock()
 	c.win.app.Stop()
 	os.Exit(0)
 }
 
-// UpdateFeeds updates the articles kept in the controller
+// UpdateFeeds fetches all feeds and updates the articles kept in the controller.
+// Remote feeds are synced with the GReader server instead.
 func (c *Controller) UpdateFeeds() {
-	c.rss.Update()
+	feeds := []Feed{}
+	for _, f := range c.Feeds() {
+		if !f.Remote {
+			feeds = append(feeds, f)
+		}
+	}
+	c.UpdateSomeFeeds(feeds)
+
+	if c.conf.GReader.URL != "" {
+		c.rLock.Lock()
+		c.nextSync = time.Time{}
+		c.rLock.Unlock()
+		go c.syncIfDue()
+	}
+}
+
+// Refresh fetches all feeds in the background. False is returned if a
+// refresh is already running.
+func (c *Controller) Refresh() bool {
+	if !c.refreshing.CompareAndSwap(false, true) {
+		return false
+	}
+	go func() {
+		defer c.refreshing.Store(false)
+		c.UpdateFeeds()
+	}()
+	return true
+}
+
+// syncIfDue syncs with the GReader server if it's time to
+func (c *Controller) syncIfDue() {
+	if !c.syncDue(time.Now()) {
+		return
+	}
+	if _, err := c.Sync(); err != nil {
+		log.Printf("Failed to sync with %s: %v", c.conf.GReader.URL, err)
+		return
+	}
+	if c.win != nil {
+		c.win.app.QueueUpdateDraw(c.showUpdates)
+	}
+}
+
+// UpdateSomeFeeds fetches the given feeds and updates the articles kept in the
+// controller. The number of new articles is returned.
+func (c *Controller) UpdateSomeFeeds(feeds []Feed) int {
+	c.uLock.Lock()
+	defer c.uLock.Unlock()
+
+	c.rss.Update(feeds)
 	news := make(map[string]int)
+	var saved []Article
 	for _, f := range c.rss.feeds {
 		if f.feed == nil {
 			continue
@@ -174,6 +324,7 @@ func (c *Controller) UpdateFeeds() {
 			}
 			a := Article{
 				c:           c,
+				guid:        ItemGUID(item),
 				feed:        f.feed.Title,
 				title:       item.Title,
 				content:     content,
@@ -182,35 +333,45 @@ func (c *Controller) UpdateFeeds() {
 				read:        false,
 				feedDisplay: f.displayName,
 			}
-			// Make sure the same article doesn't exists.
-			exists := false
-			for _, e := range c.articles {
-				if strings.EqualFold(e.title, a.title) {
-					exists = true
-				}
+			if item.Author != nil {
+				a.author = item.Author.Name
 			}
-
-			if !exists {
+			if !c.applyRules(&a) {
+				continue
+			}
+			// Only count articles that didn't already exist, and that
+			// rules haven't muted.
+			if added, _ := c.db.Save(&a); added && !a.read && !a.deleted {
 				if f.displayName != "" {
 					news[f.displayName]++
 				} else {
 					news[f.feed.Title]++
 				}
-				c.db.Save(a)
+				a.highlight = c.isHighlight(&a)
+				saved = append(saved, a)
 			}
 		}
 	}
+	go c.fetchFullContents(append([]Article{}, saved...))
+	go c.runHooks(saved)
 
 	if c.conf.Notifications {
 		// skip error handling, best effort to show notifications.
 		newArticles := ""
 		total := 0
 		for k, v := range news {
-			if v > 0 {
-				newArticles += fmt.Sprintf("[%d] %s\n", v, k)
-				total += v
+			newArticles += fmt.Sprintf("[%d] %s\n", v, k)
+			total += v
+		}
+		highlighted := 0
+		for i := range saved {
+			if saved[i].highlight {
+				highlighted++
 			}
 		}
+		if highlighted > 0 {
+			newArticles += fmt.Sprintf("[%d] Highlight\n", highlighted)
+		}
 
 		if total > 0 {
 			articles := "Articles"
@@ -221,10 +382,30 @@ func (c *Controller) UpdateFeeds() {
 		}
 	}
 
+	total := 0
+	for _, v := range news {
+		total += v
+	}
+
 	c.lastUpdate = time.Now()
+	if c.win == nil {
+		return total
+	}
+	c.win.app.QueueUpdateDraw(c.showUpdates)
+	return total
+}
+
+// showUpdates reloads the articles from the database and shows them
+func (c *Controller) showUpdates() {
 	c.GetArticlesFromDB()
 	c.isUpdated = true
 
+	// Include new articles in the search results
+	if c.win.currSearch != "" {
+		c.runSearch(c.win.currSearch)
+	}
+	c.runSavedSearches()
+
 	// On update, sort by date.
 	sort.Slice(c.articles, func(i, j int) bool {
 		return c.articles[i].published.String() > c.articles[j].published.String()
@@ -268,6 +449,65 @@ func (c *Controller) OpenLink(link string) {
 	}
 }
 
+// PreviewLink opens link n of the preview. With the prefix m, e.g. m2, the
+// link is marked to be opened instead and with c it's copied to the
+// clipboard.
+func (c *Controller) PreviewLink(input string) {
+	input = strings.TrimSpace(input)
+	action := ""
+	if strings.HasPrefix(input, "m") || strings.HasPrefix(input, "c") {
+		action, input = input[:1], strings.TrimSpace(input[1:])
+	}
+	n, err := strconv.Atoi(input)
+	if err != nil || n < 1 || n > len(c.win.links) {
+		c.win.StatusMessage(fmt.Sprintf("No link %s", input))
+		return
+	}
+	link := c.win.links[n-1]
+
+	switch action {
+	case "m":
+		for i, l := range c.linksToOpen {
+			if l == link {
+				c.linksToOpen = append(c.linksToOpen[:i], c.linksToOpen[i+1:]...)
+				c.win.StatusMessage(fmt.Sprintf("Unmarked %s", link))
+				return
+			}
+		}
+		c.linksToOpen = append(c.linksToOpen, link)
+		c.win.StatusMessage(fmt.Sprintf("Marked %s", link))
+	case "c":
+		if err := CopyToClipboard(link); err != nil {
+			c.win.StatusMessage(fmt.Sprintf("Failed to copy link: %v", err))
+			return
+		}
+		c.win.StatusMessage(fmt.Sprintf("Copied %s", link))
+	default:
+		c.OpenLink(link)
+	}
+}
+
+// CopyToClipboard copies text to the system clipboard
+func CopyToClipboard(text string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("pbcopy")
+	case "windows":
+		cmd = exec.Command("clip")
+	default:
+		if _, err := exec.LookPath("wl-copy"); err == nil && os.Getenv("WAYLAND_DISPLAY") != "" {
+			cmd = exec.Command("wl-copy")
+		} else if _, err := exec.LookPath("xclip"); err == nil {
+			cmd = exec.Command("xclip", "-selection", "clipboard")
+		} else {
+			cmd = exec.Command("xsel", "--clipboard", "--input")
+		}
+	}
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
 // ShowFeeds updates the feeds window with the current feeds and statuses
 func (c *Controller) ShowFeeds() {
 	c.win.ClearFeeds()
@@ -282,8 +522,33 @@ func (c *Controller) ShowFeeds() {
 			hc++
 		}
 	}
-	c.win.AddToFeeds(fmt.Sprintf("[%s]Highlight", c.theme.Highlights), "", hc, total, &Article{feed: "highlight"})
-	c.win.AddToFeeds(fmt.Sprintf("[%s]Search Results", c.theme.Highlights), "", c.searchResults, c.searchResults, &Article{feed: "result"})
+	c.win.AddToFeeds(fmt.Sprintf("[%s]Highlight", c.theme.Highlights), "", hc, total, false, &Article{feed: "highlight"})
+	searchHits, searchTitles, _ := c.searchHitsOf("result")
+	searchUnread := 0
+	for _, a := range c.articles {
+		if _, ok := searchTitles[a.id]; ok && !a.read {
+			searchUnread++
+		}
+	}
+	c.win.AddToFeeds(fmt.Sprintf("[%s]Search Results", c.theme.Highlights), "", searchUnread, len(searchHits), false, &Article{feed: "result"})
+	for _, s := range c.conf.Searches {
+		hits, titles, _ := c.searchHitsOf(searchPrefix + s.Name)
+		if titles == nil {
+			continue
+		}
+		unread := 0
+		for _, a := range c.articles {
+			if _, ok := titles[a.id]; ok && !a.read {
+				unread++
+			}
+		}
+		c.win.AddToFeeds(fmt.Sprintf("[%s]%s", c.theme.Highlights, tview.Escape(s.Name)), "", unread, len(hits), false, &Article{feed: searchPrefix + s.Name})
+	}
+
+	tags, tagsUnread, tagsTotal := c.articleTags()
+	for _, t := range tags {
+		c.win.AddToFeeds(fmt.Sprintf("[%s]#%s", c.theme.Tags, tview.Escape(t)), "", tagsUnread[t], tagsTotal[t], false, &Article{feed: tagPrefix + t})
+	}
 
 	type feed struct {
 		count   int
@@ -292,9 +557,17 @@ func (c *Controller) ShowFeeds() {
 	feeds := make(map[string]*feed)
 	feedsTotal := make(map[string]int)
 	urTotal := 0
+	starredTotal := 0
+	starredUnread := 0
 	total = 0
 	for _, a := range c.articles {
 		total++
+		if a.starred {
+			starredTotal++
+			if !a.read {
+				starredUnread++
+			}
+		}
 		if _, ok := feeds[a.feed]; !ok {
 			feeds[a.feed] = &feed{0, a.feedDisplay}
 			feedsTotal[a.feed] = 0
@@ -306,7 +579,8 @@ func (c *Controller) ShowFeeds() {
 		}
 	}
 
-	c.win.AddToFeeds("Unread", "", urTotal, urTotal, &Article{feed: "unread"})
+	c.win.AddToFeeds(fmt.Sprintf("[%s]Starred", c.theme.Highlights), "", starredUnread, starredTotal, false, &Article{feed: "starred"})
+	c.win.AddToFeeds("Unread", "", urTotal, urTotal, false, &Article{feed: "unread"})
 
 	// If there are no unread left, then we remove the prevArticle so that
 	// we don't add it again when updating the window.
@@ -314,7 +588,7 @@ func (c *Controller) ShowFeeds() {
 		c.prevArticle = nil
 	}
 
-	c.win.AddToFeeds("All Articles", "", urTotal, total, &Article{feed: "allarticles"})
+	c.win.AddToFeeds("All Articles", "", urTotal, total, false, &Article{feed: "allarticles"})
 
 	var keys [][2]string
 	for k := range feeds {
@@ -324,8 +598,87 @@ func (c *Controller) ShowFeeds() {
 		return keys[i][0] < keys[j][0]
 	})
 
+	// Feeds that fail to update are marked. Failing feeds that have never
+	// been fetched have no articles, they are listed by URL at the end.
+	failing := make(map[string]bool)
+	var neverFetched []Feed
+	health := c.sched.Health()
+	for _, f := range c.Feeds() {
+		if h, ok := health[f.URL]; ok && h.Failures > 0 {
+			title := c.rss.Title(f.URL)
+			if _, ok := feeds[title]; ok && title != "" {
+				failing[title] = true
+			} else {
+				neverFetched = append(neverFetched, f)
+			}
+		}
+	}
+
+	// Group the feeds by category. Feeds without a category are listed
+	// after the categories.
+	type category struct {
+		unread       int
+		total        int
+		keys         [][2]string
+		neverFetched []Feed
+	}
+	categories := make(map[string]*category)
+	getCategory := func(name string) *category {
+		if _, ok := categories[name]; !ok {
+			categories[name] = &category{}
+		}
+		return categories[name]
+	}
 	for _, k := range keys {
-		c.win.AddToFeeds(k[0], k[1], feeds[k[0]].count, feedsTotal[k[0]], &Article{feed: k[0]})
+		cat := getCategory(c.rss.Category(k[0]))
+		cat.unread += feeds[k[0]].count
+		cat.total += feedsTotal[k[0]]
+		cat.keys = append(cat.keys, k)
+	}
+	for _, f := range neverFetched {
+		cat := getCategory(f.Category)
+		cat.neverFetched = append(cat.neverFetched, f)
+	}
+
+	var names []string
+	for name := range categories {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	names = append(names, "")
+
+	for _, name := range names {
+		cat, ok := categories[name]
+		if !ok {
+			continue
+		}
+
+		indent := ""
+		if name != "" {
+			indent = "  "
+			c.win.AddCategoryToFeeds(name, c.collapsed[name], cat.unread, cat.total, &Article{feed: categoryPrefix + name})
+			if c.collapsed[name] {
+				continue
+			}
+		}
+
+		for _, k := range cat.keys {
+			display := k[1]
+			if display == "" {
+				display = k[0]
+			}
+			c.win.AddToFeeds(k[0], indent+display, feeds[k[0]].count, feedsTotal[k[0]], failing[k[0]], &Article{feed: k[0]})
+		}
+
+		for _, f := range cat.neverFetched {
+			display := f.Name
+			if display == "" {
+				display = f.URL
+			}
+			c.win.AddToFeeds(f.URL, indent+display, 0, 0, true, &Article{feed: f.URL})
+		}
 	}
 }
 
@@ -337,28 +690,41 @@ func (c *Controller) ShowArticles(feed string) {
 
 	if feed == "" {
 		feed = "highlight"
-	} else if feed == "result" {
-		c.searchResults = 0
 	}
 
 	c.activeFeed = feed
 
+	// Search results are listed in the order of the search ranking
+	if hits, _, ok := c.searchHitsOf(feed); ok {
+		idx := make(map[int]int)
+		for i, a := range c.articles {
+			idx[a.id] = i
+		}
+		for _, h := range hits {
+			if i, ok := idx[h.ID]; ok {
+				c.win.AddToArticles(&c.articles[i], c.isMarked(c.articles[i].link))
+			}
+		}
+		c.win.articles.ScrollToBeginning()
+		c.ShowFeeds()
+		return
+	}
+
 	for i, a := range c.articles {
 		if feed == "highlight" {
 			if !a.highlight {
 				continue
 			}
-		} else if feed == "result" {
-			match := false
-			for _, f := range strings.Fields(c.win.currSearch) {
-				// Insensitive search
-				if strings.Contains(strings.ToLower(a.title), strings.ToLower(f)) {
-					match = true
-					c.searchResults++
-					break
-				}
+		} else if strings.HasPrefix(feed, categoryPrefix) {
+			if c.rss.Category(a.feed) != strings.TrimPrefix(feed, categoryPrefix) {
+				continue
+			}
+		} else if strings.HasPrefix(feed, tagPrefix) {
+			if !a.HasTag(strings.TrimPrefix(feed, tagPrefix)) {
+				continue
 			}
-			if !match {
+		} else if feed == "starred" {
+			if !a.starred {
 				continue
 			}
 		} else if feed == "allarticles" {
@@ -378,15 +744,7 @@ func (c *Controller) ShowArticles(feed string) {
 				continue
 			}
 		}
-		markedWeb := false
-
-		for _, s := range c.linksToOpen {
-			if s == a.link {
-				markedWeb = true
-				break
-			}
-		}
-		c.win.AddToArticles(&c.articles[i], markedWeb)
+		c.win.AddToArticles(&c.articles[i], c.isMarked(a.link))
 	}
 	c.isUpdated = false
 
@@ -394,6 +752,64 @@ func (c *Controller) ShowArticles(feed string) {
 	c.ShowFeeds()
 }
 
+// isMarked returns true if the link is marked to be opened
+func (c *Controller) isMarked(link string) bool {
+	for _, s := range c.linksToOpen {
+		if s == link {
+			return true
+		}
+	}
+	return false
+}
+
+// Search runs a search query against the database and shows the results
+func (c *Controller) Search(query string) {
+	c.runSearch(query)
+	c.ShowArticles("result")
+	if !c.db.fts {
+		c.win.StatusMessage("Full-text search not available, only titles are searched (build with -tags sqlite_fts5)")
+	}
+}
+
+// runSearch stores the results of a search query
+func (c *Controller) runSearch(query string) {
+	hits := c.db.Search(query)
+	titles := make(map[int]string)
+	for _, h := range hits {
+		titles[h.ID] = h.Title
+	}
+
+	c.searchLock.Lock()
+	c.searchHits, c.searchTitles = hits, titles
+	c.searchLock.Unlock()
+}
+
+// AddFeedURL adds a feed in the background and fetches its articles. If the
+// URL is a web page with several feeds the user gets to choose one of them.
+func (c *Controller) AddFeedURL(url string) {
+	c.win.StatusMessage(fmt.Sprintf("Adding %s...", url))
+	go func() {
+		f, title, err := c.AddFeed(Feed{URL: url})
+
+		var derr *DiscoveryError
+		if errors.As(err, &derr) && len(derr.Candidates) > 0 {
+			c.win.app.QueueUpdateDraw(func() {
+				c.win.ChooseFeed(derr.URL, derr.Candidates, c.AddFeedURL)
+			})
+			return
+		}
+		if err != nil {
+			c.win.StatusMessage(fmt.Sprintf("Failed to add feed: %v", err))
+			return
+		}
+
+		c.win.StatusMessage(fmt.Sprintf("Added %s (%s)", f.URL, title))
+		if c.fetching() {
+			c.UpdateSomeFeeds([]Feed{f})
+		}
+	}()
+}
+
 // GetArticleForSelection returns the article instance for the selected article
 // in the aritcles table.
 func (c *Controller) GetArticleForSelection() *Article {
@@ -436,7 +852,7 @@ func (c *Controller) SelectFeed(row, col int) {
 func (c *Controller) SelectArticle(row, col int) {
 	if c.activeFeed == "unread" && row == 0 {
 		if c.prevArticle != nil {
-			c.db.MarkRead(c.prevArticle)
+			c.db.MarkSelected(c.prevArticle)
 			c.prevArticle.read = true
 			c.ShowArticles(c.activeFeed)
 			c.ShowFeeds()
@@ -452,10 +868,9 @@ func (c *Controller) SelectArticle(row, col int) {
 	c.win.preview.Clear()
 
 	if c.activeFeed != "unread" {
-		c.db.MarkRead(a)
+		c.db.MarkSelected(a)
 		a.read = true
 	}
-	c.undoArticle = c.prevArticle
 	c.prevArticle = a
 
 	c.win.AddPreview(a)
@@ -475,6 +890,9 @@ func (c *Controller) Input(e *tcell.EventKey) *tcell.EventKey {
 	case c.conf.KeySearchPromt:
 		c.win.Search()
 
+	case c.conf.KeyAddFeed:
+		c.win.AddFeed()
+
 	case c.conf.KeyQuit:
 		c.win.AskQuit()
 
@@ -513,6 +931,72 @@ func (c *Controller) Input(e *tcell.EventKey) *tcell.EventKey {
 			c.ShowArticles(c.activeFeed)
 		}
 
+	case c.conf.KeyToggleStar:
+		a := c.GetArticleForSelection()
+		if a == nil {
+			return nil
+		}
+		if err := c.db.SetStarred(a, !a.starred); err == nil {
+			a.starred = !a.starred
+		}
+		if c.activeFeed != "unread" {
+			c.ShowArticles(c.activeFeed)
+		}
+
+	case c.conf.KeyToggleCategory:
+		if c.win.app.GetFocus() != c.win.feeds {
+			return e
+		}
+		r, _ := c.win.feeds.GetSelection()
+		ref := c.win.feeds.GetCell(r, 2).GetReference()
+		if ref == nil || !strings.HasPrefix(ref.(*Article).feed, categoryPrefix) {
+			return nil
+		}
+		name := strings.TrimPrefix(ref.(*Article).feed, categoryPrefix)
+		c.collapsed[name] = !c.collapsed[name]
+		c.ShowFeeds()
+
+	case c.conf.KeySaveSearch:
+		c.win.SaveSearch()
+
+	case c.conf.KeyTag:
+		a := c.GetArticleForSelection()
+		if a == nil {
+			return nil
+		}
+		c.win.TagPrompt(a)
+
+	case c.conf.KeyLinkPrompt:
+		c.win.LinkPrompt()
+
+	case c.conf.KeyFullContent:
+		a := c.GetArticleForSelection()
+		if a == nil {
+			a = c.prevArticle
+		}
+		if a == nil {
+			return nil
+		}
+		c.win.StatusMessage(fmt.Sprintf("Fetching %s", a.link))
+		go c.showFullContent(a.id, a.link)
+
+	case c.conf.KeyExportOPML:
+		file := c.conf.OPMLExportFile
+		if file == "" {
+			file = filepath.Join(filepath.Dir(c.confFile), "gorss.opml")
+		}
+		f, err := os.Create(file)
+		if err != nil {
+			c.win.StatusMessage(fmt.Sprintf("Failed to export OPML: %v", err))
+			return nil
+		}
+		if err := c.ExportOPML(f); err != nil {
+			c.win.StatusMessage(fmt.Sprintf("Failed to export OPML: %v", err))
+		} else {
+			c.win.StatusMessage(fmt.Sprintf("Exported %d feeds to %s", len(c.Feeds()), file))
+		}
+		f.Close()
+
 	case c.conf.KeyOpenLink:
 		a := c.GetArticleForSelection()
 		if a == nil {
@@ -587,28 +1071,32 @@ func (c *Controller) Input(e *tcell.EventKey) *tcell.EventKey {
 		c.ShowArticles(c.activeFeed)
 
 	case c.conf.KeyMarkAllRead:
-		c.db.MarkAllRead("")
+		n := c.db.MarkAllRead("")
 		c.GetArticlesFromDB()
 		c.ShowArticles(c.activeFeed)
 		c.ShowFeeds()
+		c.win.StatusMessage(fmt.Sprintf("Marked %d articles as read, %s to undo", n, c.conf.KeyUndoLastRead))
 
 	case c.conf.KeyMarkAllReadFeed:
-		c.db.MarkAllRead(c.activeFeed)
+		n := c.db.MarkAllRead(c.activeFeed)
 		c.GetArticlesFromDB()
 		c.ShowArticles(c.activeFeed)
 		c.ShowFeeds()
+		c.win.StatusMessage(fmt.Sprintf("Marked %d articles as read, %s to undo", n, c.conf.KeyUndoLastRead))
 
 	case c.conf.KeyMarkAllUnread:
-		c.db.MarkAllUnread("")
+		n := c.db.MarkAllUnread("")
 		c.GetArticlesFromDB()
 		c.ShowArticles(c.activeFeed)
 		c.ShowFeeds()
+		c.win.StatusMessage(fmt.Sprintf("Marked %d articles as unread, %s to undo", n, c.conf.KeyUndoLastRead))
 
 	case c.conf.KeyMarkAllUnreadFeed:
-		c.db.MarkAllUnread(c.activeFeed)
+		n := c.db.MarkAllUnread(c.activeFeed)
 		c.GetArticlesFromDB()
 		c.ShowArticles(c.activeFeed)
 		c.ShowFeeds()
+		c.win.StatusMessage(fmt.Sprintf("Marked %d articles as unread, %s to undo", n, c.conf.KeyUndoLastRead))
 
 	case c.conf.KeySelectFeedWindow:
 		c.win.SelectFeedWindow()
@@ -630,32 +1118,25 @@ func (c *Controller) Input(e *tcell.EventKey) *tcell.EventKey {
 		c.win.TogglePreview()
 
 	case c.conf.KeyUpdateFeeds:
-		c.UpdateFeeds()
+		if !c.fetching() {
+			c.win.StatusMessage(fmt.Sprintf("Feeds are updated by process %d", lockPID(LockFile(c.dbFile))))
+			return nil
+		}
+		if !c.Refresh() {
+			c.win.StatusMessage("Feeds are already being updated")
+		}
 
 	case c.conf.KeyToggleHelp:
 		c.win.ToggleHelp()
 
-	case c.conf.KeyUndoLastRead:
-		if c.activeFeed == "unread" {
-			if c.undoArticle != nil {
-				c.undoArticle.read = false
-			}
-			if c.prevArticle != nil {
-				c.prevArticle.read = false
-			}
-			c.prevArticle = c.undoArticle
-			c.ShowArticles(c.activeFeed)
+	case c.conf.KeyToggleErrors:
+		c.win.ToggleErrors()
 
-			c.win.articles.Select(1, 2)
-		} else {
-			a := c.GetArticleForSelection()
-			if a != nil {
-				a.read = false
-			}
+	case c.conf.KeyUndoLastRead:
+		c.Undo()
 
-			r, _ := c.win.articles.GetSelection()
-			c.win.articles.Select(r-1, 2)
-		}
+	case c.conf.KeyRedo:
+		c.Redo()
 
 	case "h":
 		break
@@ -670,21 +1151,11 @@ func (c *Controller) Input(e *tcell.EventKey) *tcell.EventKey {
 		break
 
 	default:
-		for _, cmd := range c.conf.CustomCommands {
-			if keyName == cmd.Key {
-				// Substitute the parts we have support for
+		for i := range c.conf.CustomCommands {
+			if keyName == c.conf.CustomCommands[i].Key {
 				a := c.GetArticleForSelection()
 				if a != nil {
-					cmdStr := cmd.Cmd
-					cmdStr = strings.ReplaceAll(cmdStr, "ARTICLE.Title", a.title)
-					cmdStr = strings.ReplaceAll(cmdStr, "ARTICLE.Link", a.link)
-					cmdStr = strings.ReplaceAll(cmdStr, "ARTICLE.Feed", a.feed)
-					cmdStr = strings.ReplaceAll(cmdStr, "ARTICLE.Content", a.content)
-
-					command := exec.Command("/bin/sh", "-c", cmdStr)
-					if err := command.Run(); err != nil {
-						log.Printf("Failed to run command: %v", cmdStr)
-					}
+					c.RunCommand(&c.conf.CustomCommands[i], a)
 					return nil
 				}
 			}
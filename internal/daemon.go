@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Daemon fetches the feeds on their schedule, without any window, until
+// SIGINT or SIGTERM is received. Only the process holding the lock file of
+// the database fetches feeds, if a reader already holds it the daemon waits
+// until it is released. Changes to the feeds of the configuration file are
+// picked up while running.
+func (c *Controller) Daemon() error {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	log.Print(Logfmt("info", "daemon started", "pid", os.Getpid(), "db", c.dbFile, "feeds", len(c.Feeds())))
+
+	srv := c.StartAPI()
+
+	confTime := modTime(c.confFile)
+	waiting := false
+
+	tick := time.NewTicker(5 * time.Second)
+	defer tick.Stop()
+
+	for {
+		if c.fetching() {
+			if waiting {
+				log.Print(Logfmt("info", "lock acquired", "lock", LockFile(c.dbFile)))
+				waiting = false
+				// Whatever was fetched meanwhile is in the database, but
+				// the schedule starts over.
+				c.sched.Init(c)
+			}
+
+			if t := modTime(c.confFile); !t.Equal(confTime) {
+				confTime = t
+				c.reloadFeeds()
+			}
+
+			if c.syncDue(time.Now()) {
+				start := time.Now()
+				if news, err := c.Sync(); err != nil {
+					log.Print(Logfmt("error", "sync failed", "server", c.conf.GReader.URL, "err", err))
+				} else {
+					log.Print(Logfmt("info", "synced", "server", c.conf.GReader.URL, "new", news, "duration", time.Since(start).Round(time.Millisecond)))
+				}
+			}
+
+			if due := c.sched.Due(time.Now()); len(due) > 0 {
+				start := time.Now()
+				news := c.UpdateSomeFeeds(due)
+				c.cleanupIfDue()
+
+				failed := 0
+				health := c.sched.Health()
+				for _, f := range due {
+					if health[f.URL].Failures > 0 {
+						failed++
+					}
+				}
+				log.Print(Logfmt("info", "feeds updated", "feeds", len(due), "failed", failed, "new", news, "duration", time.Since(start).Round(time.Millisecond)))
+			}
+		} else if !waiting {
+			log.Print(Logfmt("info", "waiting for lock", "lock", LockFile(c.dbFile), "pid", lockPID(LockFile(c.dbFile))))
+			waiting = true
+		}
+
+		select {
+		case s := <-stop:
+			if srv != nil {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				srv.Shutdown(ctx)
+				cancel()
+			}
+			log.Print(Logfmt("info", "daemon stopped", "signal", s))
+			return c.releaseLock()
+		case <-tick.C:
+		}
+	}
+}
+
+// fetching returns true if this process fetches the feeds. The lock file
+// is acquired if no other process holds it.
+func (c *Controller) fetching() bool {
+	c.lockMu.Lock()
+	defer c.lockMu.Unlock()
+
+	if c.lock != nil {
+		return true
+	}
+
+	lock, err := AcquireLock(LockFile(c.dbFile))
+	if err != nil {
+		var lerr *LockedError
+		if !errors.As(err, &lerr) {
+			log.Printf("Failed to acquire lock: %v", err)
+		}
+		return false
+	}
+	c.lock = lock
+	return true
+}
+
+// releaseLock releases the lock file if this process holds it
+func (c *Controller) releaseLock() error {
+	c.lockMu.Lock()
+	defer c.lockMu.Unlock()
+
+	err := c.lock.Release()
+	c.lock = nil
+	return err
+}
+
+// reloadFeeds reads the feeds of the configuration file, and the OPML
+// file, again.
+func (c *Controller) reloadFeeds() {
+	cf, err := LoadConfigFile(c.confFile)
+	if err != nil {
+		log.Print(Logfmt("error", "failed to reload feeds", "err", err))
+		return
+	}
+
+	feeds := append(cf.Feeds(), c.rss.loadOPML()...)
+	c.rLock.Lock()
+	feeds = append(feeds, c.remoteFeeds...)
+	c.setFeeds(feeds)
+	c.rLock.Unlock()
+	log.Print(Logfmt("info", "feeds reloaded", "feeds", len(feeds)))
+}
+
+// modTime returns the modification time of a file
+func modTime(file string) time.Time {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
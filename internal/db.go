@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"os"
 	"strings"
 	"time"
 
@@ -12,78 +13,280 @@ import (
 
 // DB holds the database information
 type DB struct {
-	db *sql.DB
-	c  *Controller
+	db  *sql.DB
+	c   *Controller
+	fts bool
 }
 
-// Init setups the database and creates tables if needed.
+// maxVariables is the most values bound in one statement, well below the
+// limit SQLite has on the number of variables.
+const maxVariables = 500
+
+// idBatch is a batch of ids for an in clause, with its placeholders such as
+// "(?, ?)" and the ids as arguments.
+type idBatch struct {
+	in   string
+	args []interface{}
+}
+
+// batches splits ids into batches of at most maxVariables ids
+func batches(ids []int) []idBatch {
+	var bs []idBatch
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > maxVariables {
+			n = maxVariables
+		}
+		b := idBatch{in: "(?" + strings.Repeat(", ?", n-1) + ")"}
+		for _, id := range ids[:n] {
+			b.args = append(b.args, id)
+		}
+		bs = append(bs, b)
+		ids = ids[n:]
+	}
+	return bs
+}
+
+// Init setups the database and migrates it to the latest schema version.
 func (d *DB) Init(c *Controller, dbFile string) error {
 	d.c = c
-	db, err := sql.Open("sqlite3", dbFile)
+
+	existed := false
+	if fi, err := os.Stat(dbFile); err == nil && fi.Size() > 0 {
+		existed = true
+	}
+
+	// Wait for the lock of the database if another gorss is writing to it
+	db, err := sql.Open("sqlite3", dbFile+"?_busy_timeout=5000")
 	if err != nil {
 		log.Println(err)
 	}
 	d.db = db
 	//defer d.db.Close()
 
-	_, err = d.db.Exec(`
-         create table if not exists articles(
-			id integer not null primary key,
-			feed text,
-			title text,
-			content text,
-			link text,
-			read bool,
-			display_name string,
-			deleted bool,
-			published DATETIME
-		);`)
-	if err != nil {
+	if err := d.Migrate(dbFile, existed); err != nil {
 		log.Println(err)
 		return err
 	}
+
+	d.initFTS()
 	return nil
 }
 
-// CleanupDB removes old and deleted articles
-func (d *DB) CleanupDB() {
-	st, err := d.db.Prepare(fmt.Sprintf(
-		"delete from articles where published < date('now', '-%d day') and deleted = true",
-		d.c.conf.DaysToKeepDeletedArticlesInDB),
-	)
+// FeedCache returns the last known title and HTTP cache validators for a feed URL.
+func (d *DB) FeedCache(url string) (title, etag, lastModified string) {
+	st, err := d.db.Prepare("select title, etag, last_modified from feeds where url = ?")
 	if err != nil {
 		log.Println(err)
+		return
 	}
 	defer st.Close()
 
-	if _, err = st.Exec(); err != nil {
+	var t, e, l sql.NullString
+	if err := st.QueryRow(url).Scan(&t, &e, &l); err != nil {
+		if err != sql.ErrNoRows {
+			log.Println(err)
+		}
+		return
+	}
+	return t.String, e.String, l.String
+}
+
+// SaveFeedHealth stores the health of a feed and when it is fetched next
+func (d *DB) SaveFeedHealth(h *FeedHealth, next time.Time) {
+	_, err := d.db.Exec(`
+		insert into feeds(url, failures, last_error, errors, last_success, next_fetch) values(?, ?, ?, ?, ?, ?)
+		on conflict(url) do update set failures = excluded.failures, last_error = excluded.last_error,
+			errors = excluded.errors, last_success = excluded.last_success, next_fetch = excluded.next_fetch`,
+		h.URL, h.Failures, h.LastError, strings.Join(h.Errors, "\n"), nullTime(h.LastSuccess), next.UTC())
+	if err != nil {
 		log.Println(err)
 	}
+}
 
-	st2, err := d.db.Prepare(fmt.Sprintf(
-		"delete from articles where published < date('now', '-%d day') and read = true",
-		d.c.conf.DaysToKeepReadArticlesInDB),
-	)
+// FeedHealth returns the stored health of all feeds that have been fetched,
+// and when the failing feeds are fetched next.
+func (d *DB) FeedHealth() (map[string]*FeedHealth, map[string]time.Time) {
+	health := make(map[string]*FeedHealth)
+	next := make(map[string]time.Time)
+
+	rows, err := d.db.Query("select url, failures, coalesce(last_error, ''), coalesce(errors, ''), last_success, next_fetch from feeds where failures > 0 or last_success is not null")
 	if err != nil {
 		log.Println(err)
+		return health, next
 	}
-	defer st2.Close()
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			h             FeedHealth
+			errors        string
+			success, when sql.NullTime
+		)
+		if err := rows.Scan(&h.URL, &h.Failures, &h.LastError, &errors, &success, &when); err != nil {
+			log.Println(err)
+			continue
+		}
+		if errors != "" {
+			h.Errors = strings.Split(errors, "\n")
+		}
+		h.LastSuccess = success.Time
+		health[h.URL] = &h
+		if h.Failures > 0 && when.Valid {
+			next[h.URL] = when.Time
+		}
+	}
+	return health, next
+}
+
+// nullTime stores the zero time as null
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+// FeedTitles returns the last known title of all feed URLs
+func (d *DB) FeedTitles() map[string]string {
+	return d.feedColumn("title")
+}
+
+// FeedLinks returns the website link of all feed URLs
+func (d *DB) FeedLinks() map[string]string {
+	return d.feedColumn("link")
+}
 
-	if _, err := st2.Exec(); err != nil {
+// FeedIDs returns the id of all feed URLs
+func (d *DB) FeedIDs() map[string]int {
+	ids := make(map[string]int)
+
+	rows, err := d.db.Query("select rowid, url from feeds")
+	if err != nil {
 		log.Println(err)
+		return ids
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var url string
+		if err := rows.Scan(&id, &url); err != nil {
+			log.Println(err)
+			continue
+		}
+		ids[url] = id
 	}
+	return ids
+}
+
+// feedColumn returns a column of the feeds table by feed URL
+func (d *DB) feedColumn(column string) map[string]string {
+	values := make(map[string]string)
+
+	rows, err := d.db.Query(fmt.Sprintf("select url, %s from feeds", column))
+	if err != nil {
+		log.Println(err)
+		return values
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var url string
+		var value sql.NullString
+		if err := rows.Scan(&url, &value); err != nil {
+			log.Println(err)
+			continue
+		}
+		values[url] = value.String
+	}
+	return values
+}
+
+// SaveFeedCache stores the title, website link and HTTP cache validators for a feed URL.
+func (d *DB) SaveFeedCache(url, title, link, etag, lastModified string) {
+	st, err := d.db.Prepare(`
+		insert into feeds(url, title, link, etag, last_modified) values(?, ?, ?, ?, ?)
+		on conflict(url) do update set title = excluded.title, link = excluded.link, etag = excluded.etag, last_modified = excluded.last_modified`)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer st.Close()
+
+	if _, err := st.Exec(url, title, link, etag, lastModified); err != nil {
+		log.Println(err)
+	}
+}
+
+// CleanupDB removes old and deleted articles. Starred and tagged articles are
+// never removed.
+func (d *DB) CleanupDB() {
+	var ids []int
+	for _, where := range []string{
+		fmt.Sprintf("published < date('now', '-%d day') and deleted = true", d.c.conf.DaysToKeepDeletedArticlesInDB),
+		fmt.Sprintf("published < date('now', '-%d day') and read = true", d.c.conf.DaysToKeepReadArticlesInDB),
+	} {
+		ids = append(ids, d.ids("select id from articles where "+where+" and starred = false and id not in (select article_id from article_tags)")...)
+	}
+
+	for _, b := range batches(ids) {
+		if _, err := d.db.Exec("delete from articles where id in "+b.in, b.args...); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if _, err := d.db.Exec("delete from article_tags where article_id not in (select id from articles)"); err != nil {
+		log.Println(err)
+	}
+
+	d.trimJournal()
+	d.unindex(ids...)
+}
+
+// ids returns the ids selected by a query
+func (d *DB) ids(query string, args ...interface{}) []int {
+	var ids []int
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		log.Println(err)
+		return ids
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			log.Println(err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
 }
 
 // All fetches all articles from the database
 func (d *DB) All() []Article {
-	st, err := d.db.Prepare("select id,feed,title,content,published,link,read,display_name from articles where deleted = false order by id")
+	return d.articles("1 = 1")
+}
+
+// Articles fetches the articles with the given ids from the database, in
+// batches to stay below the variable limit of SQLite.
+func (d *DB) Articles(ids []int) []Article {
+	articles := []Article{}
+	for _, b := range batches(ids) {
+		articles = append(articles, d.articles("id in "+b.in, b.args...)...)
+	}
+	return articles
+}
+
+// articles fetches the articles matching a where clause that aren't deleted
+func (d *DB) articles(where string, args ...interface{}) []Article {
+	st, err := d.db.Prepare("select id,feed,title,content,published,link,read,display_name,starred,coalesce(full_content, ''),coalesce(author, ''),coalesce(color, '') from articles where deleted = false and (" + where + ") order by id")
 	if err != nil {
 		log.Println(err)
 		return nil
 	}
 	defer st.Close()
 
-	rows, err := st.Query()
+	rows, err := st.Query(args...)
 	if err != nil {
 		log.Println(err)
 		return nil
@@ -94,162 +297,297 @@ func (d *DB) All() []Article {
 		id        int
 		title     string
 		content   string
+		full      string
+		author    string
+		color     string
 		feed      string
 		link      string
 		read      bool
+		starred   bool
 		display   string
 		published time.Time
 	)
 
 	articles := []Article{}
+	tags := d.tags()
 
 	for rows.Next() {
-		err = rows.Scan(&id, &feed, &title, &content, &published, &link, &read, &display)
+		err = rows.Scan(&id, &feed, &title, &content, &published, &link, &read, &display, &starred, &full, &author, &color)
 		if err != nil {
 			log.Println(err)
 		}
 
-		// Check if we should higlight it
-		fields := strings.Fields(title)
-		highlight := false
-		for _, f := range fields {
-			for _, h := range d.c.conf.Highlights {
-				if strings.Contains(strings.ToLower(f), strings.ToLower(h)) {
-					highlight = true
-					break
-				}
-			}
-			if highlight {
-				break
-			}
-		}
-		articles = append(articles, Article{id: id, highlight: highlight, feed: feed, title: title, content: content, published: published, link: link, read: read, feedDisplay: display})
+		a := Article{id: id, feed: feed, title: title, content: content, published: published, link: link, read: read, starred: starred, feedDisplay: display, fullContent: full, author: author, color: color, tags: tags[id]}
+		a.highlight = d.c.isHighlight(&a)
+		articles = append(articles, a)
 	}
 	return articles
 }
 
-// Save adds a new article to database if the title doesn't already exists.
-func (d *DB) Save(a Article) error {
+// tags returns the tags of all articles by id
+func (d *DB) tags() map[int][]string {
+	tags := make(map[int][]string)
+
+	rows, err := d.db.Query("select article_id, tag from article_tags order by tag")
+	if err != nil {
+		log.Println(err)
+		return tags
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			log.Println(err)
+			continue
+		}
+		tags[id] = append(tags[id], tag)
+	}
+	return tags
+}
+
+// LatestID returns the id of the newest article in the database
+func (d *DB) LatestID() int {
+	var id sql.NullInt64
+	if err := d.db.QueryRow("select max(id) from articles").Scan(&id); err != nil {
+		log.Println(err)
+	}
+	return int(id.Int64)
+}
+
+// Save adds a new article to database if an article with the same guid
+// doesn't already exist in the feed. Returns true if the article was added,
+// the id of the article is then set.
+func (d *DB) Save(a *Article) (bool, error) {
 	// First make sure that the same article doesn't already exists.
-	st, err := d.db.Prepare("select title from articles where feed = ? and title = ? order by id")
+	st, err := d.db.Prepare("select id from articles where feed = ? and guid = ?")
 	if err != nil {
 		log.Println(err)
+		return false, err
 	}
 	defer st.Close()
 
-	res, err := st.Query(a.feed, a.title)
-	if err != nil {
+	var id int
+	err = st.QueryRow(a.feed, a.guid).Scan(&id)
+	if err == nil {
+		return false, nil
+	} else if err != sql.ErrNoRows {
 		log.Println(err)
+		return false, err
 	}
-	defer res.Close()
-	for res.Next() {
-		return nil
+
+	// Articles stored before guids were used got their link as guid, adopt
+	// the real guid instead of storing the article again.
+	if a.link != "" && a.guid != a.link {
+		res, err := d.db.Exec("update articles set guid = ? where feed = ? and guid = ?", a.guid, a.feed, a.link)
+		if err != nil {
+			log.Println(err)
+			return false, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			return false, nil
+		}
 	}
 
 	tx, err := d.db.Begin()
 	if err != nil {
 		log.Println(err)
+		return false, err
 	}
+	defer tx.Rollback()
 
-	st, err = tx.Prepare("insert into articles(feed, title, content, link, read, display_name, published, deleted) values(?, ?, ?, ?, ?, ?, ?,?)")
+	st, err = tx.Prepare(`
+		insert into articles(feed, guid, title, content, link, read, display_name, published, deleted, starred, author, color, read_changed, starred_changed)
+		values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		log.Println(err)
+		return false, err
 	}
 	defer st.Close()
 
-	if _, err := st.Exec(a.feed, a.title, a.content, a.link, false, a.feedDisplay, a.published, false); err != nil {
+	// Articles marked by rules are changed locally, and must be synced
+	var readChanged, starredChanged interface{}
+	if a.read {
+		readChanged = time.Now().UTC()
+	}
+	if a.starred {
+		starredChanged = time.Now().UTC()
+	}
+	res, err := st.Exec(a.feed, a.guid, a.title, a.content, a.link, a.read, a.feedDisplay, a.published, a.deleted, a.starred, a.author, a.color, readChanged, starredChanged)
+	if err != nil {
 		log.Println(err)
+		return false, err
 	}
 
-	tx.Commit()
-	return nil
-}
-
-// Delete marks an article as deleted. Will not remove it from DB (see CleanupDB)
-func (d *DB) Delete(a *Article) {
-	st, err := d.db.Prepare("update articles set deleted = true where id = ?")
+	rowID, err := res.LastInsertId()
 	if err != nil {
 		log.Println(err)
+		return false, err
 	}
-	defer st.Close()
+	a.id = int(rowID)
 
-	if _, err := st.Exec(a.id); err != nil {
-		log.Println(err)
+	for _, t := range a.tags {
+		if _, err := tx.Exec("insert or ignore into article_tags(article_id, tag) values(?, ?)", a.id, t); err != nil {
+			log.Println(err)
+			return false, err
+		}
 	}
-}
 
-// MarkRead marks an article as read in the database
-func (d *DB) MarkRead(a *Article) error {
-	st, err := d.db.Prepare("update articles set read = true where id = ?")
-	if err != nil {
-		log.Println(err)
+	if !a.deleted {
+		if err := d.index(tx, *a); err != nil {
+			log.Println(err)
+			return false, err
+		}
 	}
-	defer st.Close()
 
-	if _, err := st.Exec(a.id); err != nil {
+	if err := tx.Commit(); err != nil {
 		log.Println(err)
+		return false, err
 	}
-	return nil
+	return true, nil
+}
+
+// Delete marks an article as deleted. Will not remove it from DB (see CleanupDB)
+func (d *DB) Delete(a *Article) {
+	d.change("delete", fmt.Sprintf("delete %q", a.title), "id = ?", a.id)
+}
+
+// MarkRead marks articles as read in the database, as one change in the
+// journal.
+func (d *DB) MarkRead(articles ...*Article) error {
+	if len(articles) == 0 {
+		return nil
+	}
+	description := fmt.Sprintf("read %q", articles[0].title)
+	if len(articles) > 1 {
+		description = fmt.Sprintf("mark %d articles read", len(articles))
+	}
+	ids := make([]int, len(articles))
+	for i, a := range articles {
+		ids[i] = a.id
+	}
+	_, err := d.changeIDs("read", description, ids)
+	return err
+}
+
+// MarkSelected marks an article read when it is selected in the reader. It
+// is recorded in the journal without clearing the changes that can be
+// redone, so moving around in the articles doesn't lose them.
+func (d *DB) MarkSelected(a *Article) error {
+	_, err := d.change("select", fmt.Sprintf("read %q", a.title), "id = ?", a.id)
+	return err
 }
 
 // MarkUnread marks an article as unread in the database
-func (d *DB) MarkUnread(a Article) error {
-	st, err := d.db.Prepare("update articles set read = false where id = '?'")
+func (d *DB) MarkUnread(a *Article) error {
+	return d.SetRead(a, false)
+}
+
+// SetRead marks an article as read or unread in the database
+func (d *DB) SetRead(a *Article, read bool) error {
+	if read {
+		return d.MarkRead(a)
+	}
+	_, err := d.change("unread", fmt.Sprintf("mark %q unread", a.title), "id = ?", a.id)
+	return err
+}
+
+// SetStarred stars or unstars an article in the database
+func (d *DB) SetStarred(a *Article, starred bool) error {
+	st, err := d.db.Prepare("update articles set starred = ?, starred_changed = ? where id = ?")
 	if err != nil {
 		log.Println(err)
+		return err
 	}
 	defer st.Close()
 
-	if err := st.QueryRow(a.id); err != nil {
+	if _, err := st.Exec(starred, time.Now().UTC(), a.id); err != nil {
 		log.Println(err)
+		return err
 	}
 	return nil
 }
 
-// MarkAllRead marks all articles in the database as read
-func (d *DB) MarkAllRead(feed string) {
-	stmt := "update articles set read = true"
-	if feed != "" {
-		stmt = "update articles set read = true where feed = ?"
+// SetFullContent stores the full content of an article, extracted from its
+// web page.
+func (d *DB) SetFullContent(a *Article) error {
+	if _, err := d.db.Exec("update articles set full_content = ? where id = ?", a.fullContent, a.id); err != nil {
+		log.Println(err)
+		return err
 	}
+	return nil
+}
 
-	st, err := d.db.Prepare(stmt)
+// SetTags replaces the tags of an article in the database
+func (d *DB) SetTags(a *Article) error {
+	tx, err := d.db.Begin()
 	if err != nil {
 		log.Println(err)
+		return err
 	}
-	defer st.Close()
+	defer tx.Rollback()
 
-	if feed != "" {
-		if _, err := st.Exec(feed); err != nil {
-			log.Println(err)
-		}
-	} else {
-		if _, err := st.Exec(); err != nil {
+	if _, err := tx.Exec("delete from article_tags where article_id = ?", a.id); err != nil {
+		log.Println(err)
+		return err
+	}
+	for _, t := range a.tags {
+		if _, err := tx.Exec("insert or ignore into article_tags(article_id, tag) values(?, ?)", a.id, t); err != nil {
 			log.Println(err)
+			return err
 		}
 	}
-}
-
-// MarkAllUnread marks all articles in the database as not read
-func (d *DB) MarkAllUnread(feed string) {
-	stmt := "update articles set read = false"
-	if feed != "" {
-		stmt = "update articles set read = false where feed = ?"
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return err
 	}
+	return nil
+}
 
-	st, err := d.db.Prepare(stmt)
+// AllTags returns the tags in use with the number of articles of each
+func (d *DB) AllTags() map[string]int {
+	tags := make(map[string]int)
+	rows, err := d.db.Query("select tag, count(*) from article_tags join articles on articles.id = article_id where deleted = false group by tag")
 	if err != nil {
 		log.Println(err)
+		return tags
 	}
-	defer st.Close()
+	defer rows.Close()
 
-	if feed != "" {
-		if _, err := st.Exec(feed); err != nil {
-			log.Println(err)
-		}
-	} else {
-		if _, err := st.Exec(); err != nil {
+	for rows.Next() {
+		var (
+			tag string
+			n   int
+		)
+		if err := rows.Scan(&tag, &n); err != nil {
 			log.Println(err)
+			continue
 		}
+		tags[tag] = n
+	}
+	return tags
+}
+
+// MarkAllRead marks all articles in the database as read, or all articles
+// of a feed, and returns the number of articles marked.
+func (d *DB) MarkAllRead(feed string) int {
+	return d.markAll("read", feed)
+}
+
+// MarkAllUnread marks all articles in the database as not read, or all
+// articles of a feed, and returns the number of articles marked.
+func (d *DB) MarkAllUnread(feed string) int {
+	return d.markAll("unread", feed)
+}
+
+// markAll marks all articles, or all articles of a feed, as read or unread
+// as one change in the journal.
+func (d *DB) markAll(action, feed string) int {
+	if feed == "" {
+		n, _ := d.change(action, "mark all "+action, "1 = 1")
+		return n
 	}
+	n, _ := d.change(action, fmt.Sprintf("mark all %s in %s", action, feed), "feed = ?", feed)
+	return n
 }
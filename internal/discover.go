@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html"
+)
+
+// feedTypes are the link types of feeds announced by web pages
+var feedTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+}
+
+// commonFeedPaths are tried when a web page doesn't announce any feeds
+var commonFeedPaths = []string{"/feed", "/rss.xml", "/atom.xml", "/feed.xml", "/index.xml", "/rss"}
+
+// DiscoveryError is returned when a URL is a web page with more than one
+// feed, or no feeds at all.
+type DiscoveryError struct {
+	URL        string
+	Candidates []string
+}
+
+func (e *DiscoveryError) Error() string {
+	if len(e.Candidates) == 0 {
+		return fmt.Sprintf("%s is a web page without any feeds", e.URL)
+	}
+	return fmt.Sprintf("%s is a web page with %d feeds: %s", e.URL, len(e.Candidates), strings.Join(e.Candidates, ", "))
+}
+
+// Discover returns the feeds of a URL. If the URL is a feed itself it is
+// returned as is, together with the parsed feed. For web pages the feeds
+// announced with <link rel="alternate"> are returned, or if there are none,
+// the feeds found at common paths such as /feed and /rss.xml. The URL is
+// only fetched once.
+func (r *RSS) Discover(pageURL string) (*gofeed.Feed, []string, error) {
+	resp, err := r.get(pageURL, "", "")
+	if err != nil {
+		return nil, nil, err
+	}
+	base := resp.Request.URL
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if feed, err := parseFeed(bytes.NewReader(body)); err == nil {
+		return feed, []string{pageURL}, nil
+	}
+
+	candidates := FeedLinks(bytes.NewReader(body), base)
+	if len(candidates) > 0 {
+		return nil, candidates, nil
+	}
+
+	for _, p := range commonFeedPaths {
+		u := base.ResolveReference(&url.URL{Path: p}).String()
+		if _, err := r.ParseURL(u); err == nil {
+			candidates = append(candidates, u)
+		}
+	}
+	return nil, candidates, nil
+}
+
+// FeedLinks returns the feeds announced by a HTML page with
+// <link rel="alternate" type="application/rss+xml" href="...">. Relative
+// links are resolved against base.
+func FeedLinks(page io.Reader, base *url.URL) []string {
+	var links []string
+	seen := make(map[string]bool)
+
+	z := html.NewTokenizer(page)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) == "body" {
+				return links
+			}
+			if string(name) != "link" || !hasAttr {
+				continue
+			}
+
+			var rel, typ, href string
+			for {
+				k, v, more := z.TagAttr()
+				switch string(k) {
+				case "rel":
+					rel = strings.ToLower(string(v))
+				case "type":
+					typ = strings.ToLower(strings.TrimSpace(string(v)))
+				case "href":
+					href = strings.TrimSpace(string(v))
+				}
+				if !more {
+					break
+				}
+			}
+
+			if !strings.Contains(rel, "alternate") || !feedTypes[typ] || href == "" {
+				continue
+			}
+			u, err := base.Parse(href)
+			if err != nil {
+				continue
+			}
+			if link := u.String(); !seen[link] {
+				seen[link] = true
+				links = append(links, link)
+			}
+		}
+	}
+}
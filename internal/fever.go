@@ -0,0 +1,371 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"hash/crc32"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// feverMaxItems is the number of items returned per request, as in Fever
+const feverMaxItems = 50
+
+// feverGroup is a category in the Fever API
+type feverGroup struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+// feverFeedsGroup lists the feeds of a group in the Fever API
+type feverFeedsGroup struct {
+	GroupID int    `json:"group_id"`
+	FeedIDs string `json:"feed_ids"`
+}
+
+// feverFeed is a feed in the Fever API
+type feverFeed struct {
+	ID                int    `json:"id"`
+	FaviconID         int    `json:"favicon_id"`
+	Title             string `json:"title"`
+	URL               string `json:"url"`
+	SiteURL           string `json:"site_url"`
+	IsSpark           int    `json:"is_spark"`
+	LastUpdatedOnTime int64  `json:"last_updated_on_time"`
+}
+
+// feverItem is an article in the Fever API
+type feverItem struct {
+	ID            int    `json:"id"`
+	FeedID        int    `json:"feed_id"`
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	HTML          string `json:"html"`
+	URL           string `json:"url"`
+	IsSaved       int    `json:"is_saved"`
+	IsRead        int    `json:"is_read"`
+	CreatedOnTime int64  `json:"created_on_time"`
+}
+
+// feverState holds the feeds and articles as seen by the Fever API. Only
+// articles of the configured feeds are included.
+type feverState struct {
+	feeds    []feverFeed
+	groups   []feverGroup
+	members  map[int][]int
+	articles []Article
+	feedOf   map[int]int
+	// byTitle is the id of each feed by the feed name of its articles
+	byTitle map[string]int
+}
+
+// FeverHandler serves the Fever API (https://feedafever.com/api), which is
+// used by mobile clients such as Reeder to sync with gorss. Requests are
+// authenticated with api_key, the md5 sum of "username:password", which
+// must match feverAPIKey.
+func (c *Controller) FeverHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		resp := map[string]interface{}{"api_version": 3, "auth": 0}
+		key := strings.ToLower(r.FormValue("api_key"))
+		if subtle.ConstantTimeCompare([]byte(key), []byte(strings.ToLower(c.conf.FeverAPIKey))) != 1 {
+			apiJSON(w, http.StatusOK, resp)
+			return
+		}
+		resp["auth"] = 1
+
+		refreshed := c.lastUpdate
+		if refreshed.IsZero() {
+			refreshed = time.Now()
+		}
+		resp["last_refreshed_on_time"] = refreshed.Unix()
+
+		if err := c.feverMark(r); err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		s := c.feverState()
+		q := r.URL.Query()
+		if _, ok := q["groups"]; ok {
+			resp["groups"] = s.groups
+			resp["feeds_groups"] = s.feedsGroups()
+		}
+		if _, ok := q["feeds"]; ok {
+			resp["feeds"] = s.feeds
+			resp["feeds_groups"] = s.feedsGroups()
+		}
+		if _, ok := q["favicons"]; ok {
+			resp["favicons"] = []struct{}{}
+		}
+		if _, ok := q["links"]; ok {
+			resp["links"] = []struct{}{}
+		}
+		if _, ok := q["items"]; ok {
+			resp["items"] = s.items(q)
+			resp["total_items"] = len(s.articles)
+		}
+		if _, ok := q["unread_item_ids"]; ok || r.FormValue("mark") != "" {
+			resp["unread_item_ids"] = s.ids(func(a *Article) bool { return !a.read })
+		}
+		if _, ok := q["saved_item_ids"]; ok || r.FormValue("mark") != "" {
+			resp["saved_item_ids"] = s.ids(func(a *Article) bool { return a.starred })
+		}
+
+		apiJSON(w, http.StatusOK, resp)
+	})
+}
+
+// feverMark handles the mark requests, e.g. mark=item&as=read&id=1
+func (c *Controller) feverMark(r *http.Request) error {
+	mark := r.FormValue("mark")
+	if mark == "" {
+		return nil
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		return err
+	}
+	as := r.FormValue("as")
+
+	if mark == "item" {
+		switch as {
+		case "read", "unread":
+			return c.SetArticleRead(id, as == "read")
+		case "saved", "unsaved":
+			return c.SetArticleStarred(id, as == "saved")
+		}
+		return nil
+	}
+
+	// Feeds and groups can only be marked as read, up to the time the
+	// client last refreshed.
+	if as != "read" || (mark != "feed" && mark != "group") {
+		return nil
+	}
+	before := time.Now()
+	if b, err := strconv.ParseInt(r.FormValue("before"), 10, 64); err == nil && b > 0 {
+		before = time.Unix(b, 0)
+	}
+
+	s := c.feverFeeds()
+	feeds := make(map[int]bool)
+	if mark == "feed" {
+		feeds[id] = true
+	} else if id == 0 {
+		// Group 0 is all feeds
+		for _, f := range s.feeds {
+			feeds[f.ID] = true
+		}
+	} else {
+		for _, f := range s.members[id] {
+			feeds[f] = true
+		}
+	}
+
+	var ids []int
+	for _, a := range c.db.unreadArticles() {
+		if feeds[s.byTitle[a.feed]] && !a.published.After(before) {
+			ids = append(ids, a.id)
+		}
+	}
+	return c.changeArticles(ids, func(articles []*Article) error {
+		if err := c.db.MarkRead(articles...); err != nil {
+			return err
+		}
+		for _, a := range articles {
+			a.read = true
+		}
+		return nil
+	})
+}
+
+// feverState returns the feeds, groups and articles for the Fever API
+func (c *Controller) feverState() *feverState {
+	s := c.feverFeeds()
+	for _, a := range c.db.All() {
+		if id, ok := s.byTitle[a.feed]; ok {
+			s.feedOf[a.id] = id
+			s.articles = append(s.articles, a)
+		}
+	}
+	return s
+}
+
+// feverFeeds returns the feeds and groups for the Fever API, without the
+// articles.
+func (c *Controller) feverFeeds() *feverState {
+	s := &feverState{members: make(map[int][]int), feedOf: make(map[int]int), byTitle: make(map[string]int)}
+
+	ids := c.db.FeedIDs()
+	links := c.db.FeedLinks()
+	health := c.sched.Health()
+	groups := make(map[string]int)
+
+	for _, f := range c.Feeds() {
+		id, ok := ids[f.URL]
+		if !ok {
+			// Never fetched
+			continue
+		}
+		title := c.rss.Title(f.URL)
+		s.byTitle[title] = id
+
+		name := f.Name
+		if name == "" {
+			name = title
+		}
+		feed := feverFeed{ID: id, Title: name, URL: f.URL, SiteURL: links[f.URL]}
+		if h, ok := health[f.URL]; ok && !h.LastSuccess.IsZero() {
+			feed.LastUpdatedOnTime = h.LastSuccess.Unix()
+		}
+		s.feeds = append(s.feeds, feed)
+
+		if f.Category != "" {
+			// Categories have no ids, use a hash of the name so that they
+			// stay the same between requests.
+			gid := int(crc32.ChecksumIEEE([]byte(f.Category)) & 0x7fffffff)
+			if _, ok := groups[f.Category]; !ok {
+				groups[f.Category] = gid
+				s.groups = append(s.groups, feverGroup{ID: gid, Title: f.Category})
+			}
+			s.members[gid] = append(s.members[gid], id)
+		}
+	}
+
+	if s.feeds == nil {
+		s.feeds = []feverFeed{}
+	}
+	if s.groups == nil {
+		s.groups = []feverGroup{}
+	}
+	return s
+}
+
+// feedsGroups returns the feeds of each group
+func (s *feverState) feedsGroups() []feverFeedsGroup {
+	fg := []feverFeedsGroup{}
+	for _, g := range s.groups {
+		fg = append(fg, feverFeedsGroup{GroupID: g.ID, FeedIDs: joinIDs(s.members[g.ID])})
+	}
+	return fg
+}
+
+// items returns the items selected by since_id, max_id or with_ids
+func (s *feverState) items(q map[string][]string) []feverItem {
+	get := func(k string) string {
+		if v, ok := q[k]; ok && len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	var selected []Article
+	switch {
+	case get("with_ids") != "":
+		want := make(map[int]bool)
+		for _, v := range strings.Split(get("with_ids"), ",") {
+			if id, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+				want[id] = true
+			}
+		}
+		for _, a := range s.articles {
+			if want[a.id] {
+				selected = append(selected, a)
+			}
+		}
+	case get("max_id") != "":
+		max, _ := strconv.Atoi(get("max_id"))
+		for i := len(s.articles) - 1; i >= 0; i-- {
+			if s.articles[i].id < max {
+				selected = append(selected, s.articles[i])
+			}
+		}
+	default:
+		since, _ := strconv.Atoi(get("since_id"))
+		for _, a := range s.articles {
+			if a.id > since {
+				selected = append(selected, a)
+			}
+		}
+	}
+
+	if len(selected) > feverMaxItems {
+		selected = selected[:feverMaxItems]
+	}
+
+	items := []feverItem{}
+	for _, a := range selected {
+		items = append(items, feverItem{
+			ID:            a.id,
+			FeedID:        s.feedOf[a.id],
+			Title:         a.title,
+			Author:        a.author,
+			HTML:          a.content,
+			URL:           a.link,
+			IsSaved:       feverBool(a.starred),
+			IsRead:        feverBool(a.read),
+			CreatedOnTime: a.published.Unix(),
+		})
+	}
+	return items
+}
+
+// ids returns the ids of the articles matching a condition, comma separated
+func (s *feverState) ids(match func(a *Article) bool) string {
+	var ids []int
+	for i := range s.articles {
+		if match(&s.articles[i]) {
+			ids = append(ids, s.articles[i].id)
+		}
+	}
+	return joinIDs(ids)
+}
+
+// joinIDs returns ids sorted and comma separated
+func joinIDs(ids []int) string {
+	sort.Ints(ids)
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.Itoa(id)
+	}
+	return strings.Join(s, ",")
+}
+
+// feverBool converts a bool to the 0/1 used by the Fever API
+func feverBool(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// unreadArticles returns the id, feed and publish time of the unread
+// articles
+func (d *DB) unreadArticles() []Article {
+	rows, err := d.db.Query("select id, feed, published from articles where read != true and deleted = false")
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	defer rows.Close()
+
+	var articles []Article
+	for rows.Next() {
+		var a Article
+		if err := rows.Scan(&a.id, &a.feed, &a.published); err != nil {
+			log.Println(err)
+			continue
+		}
+		articles = append(articles, a)
+	}
+	return articles
+}
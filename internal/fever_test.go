@@ -0,0 +1,262 @@
+package internal
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	feverGoFeed   = "https://go.example.com/feed"
+	feverNewsFeed = "https://news.example.com/feed"
+)
+
+// newFeverServer returns a Fever API server with 60 articles in a feed in
+// the category Go and 5 in a feed without category.
+func newFeverServer(t *testing.T) (*Controller, *httptest.Server, string, []*Article, []*Article) {
+	t.Helper()
+
+	key := fmt.Sprintf("%x", md5.Sum([]byte("user:secret")))
+	c := newTestController(t, fmt.Sprintf(`{
+		"feeds": [{"url": %q, "category": "Go"}, %q],
+		"feverAPIKey": %q
+	}`, feverGoFeed, feverNewsFeed, key))
+
+	addTestFeed(c, feverGoFeed, "Go Blog")
+	addTestFeed(c, feverNewsFeed, "News")
+	goArticles := addTestArticles(t, c, "Go Blog", 60)
+	news := addTestArticles(t, c, "News", 5)
+
+	srv := httptest.NewServer(c.FeverHandler())
+	t.Cleanup(srv.Close)
+	return c, srv, key, goArticles, news
+}
+
+// feverResponse is the part of a Fever API response used by the tests
+type feverResponse struct {
+	Auth          int         `json:"auth"`
+	Items         []feverItem `json:"items"`
+	TotalItems    int         `json:"total_items"`
+	Feeds         []feverFeed `json:"feeds"`
+	UnreadItemIDs string      `json:"unread_item_ids"`
+	SavedItemIDs  string      `json:"saved_item_ids"`
+}
+
+// fever posts a request to the Fever API, as clients do
+func fever(t *testing.T, srv *httptest.Server, key, query string, form url.Values) feverResponse {
+	t.Helper()
+
+	if form == nil {
+		form = url.Values{}
+	}
+	if key != "" {
+		form.Set("api_key", key)
+	}
+	resp, err := http.PostForm(srv.URL+"/fever/?api&"+query, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s: status %d", query, resp.StatusCode)
+	}
+
+	var r feverResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func itemIDs(items []feverItem) []int {
+	ids := make([]int, len(items))
+	for i, it := range items {
+		ids[i] = it.ID
+	}
+	return ids
+}
+
+func TestFeverAuth(t *testing.T) {
+	_, srv, key, _, _ := newFeverServer(t)
+
+	tests := []struct {
+		name string
+		key  string
+		auth int
+	}{
+		{"no key", "", 0},
+		{"wrong key", fmt.Sprintf("%x", md5.Sum([]byte("user:wrong"))), 0},
+		{"key", key, 1},
+		{"upper case key", strings.ToUpper(key), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := fever(t, srv, tt.key, "items", nil)
+			if r.Auth != tt.auth {
+				t.Errorf("auth = %d, want %d", r.Auth, tt.auth)
+			}
+			if tt.auth == 0 && r.Items != nil {
+				t.Errorf("items returned without authentication")
+			}
+		})
+	}
+}
+
+func TestFeverItems(t *testing.T) {
+	_, srv, key, goArticles, news := newFeverServer(t)
+	all := append(goArticles, news...)
+
+	// The first request returns the oldest items, at most 50
+	r := fever(t, srv, key, "items", nil)
+	if r.TotalItems != 65 {
+		t.Errorf("total_items = %d, want 65", r.TotalItems)
+	}
+	if len(r.Items) != feverMaxItems {
+		t.Fatalf("got %d items, want %d", len(r.Items), feverMaxItems)
+	}
+	if r.Items[0].ID != all[0].id || r.Items[49].ID != all[49].id {
+		t.Errorf("items %v, want the first 50", itemIDs(r.Items))
+	}
+	first := r.Items[0]
+	if first.Author != "Jane Doe" || first.Title != all[0].title || first.URL != all[0].link || first.HTML != all[0].content {
+		t.Errorf("item %+v doesn't match article", first)
+	}
+	if first.FeedID == 0 || first.CreatedOnTime != all[0].published.Unix() {
+		t.Errorf("item %+v has no feed or time", first)
+	}
+
+	// since_id returns the items after it
+	r = fever(t, srv, key, "items&since_id="+strconv.Itoa(all[49].id), nil)
+	if len(r.Items) != 15 || r.Items[0].ID != all[50].id {
+		t.Errorf("since_id: items %v, want the last 15", itemIDs(r.Items))
+	}
+
+	// max_id returns the items before it, newest first
+	r = fever(t, srv, key, "items&max_id="+strconv.Itoa(all[10].id), nil)
+	if len(r.Items) != 10 || r.Items[0].ID != all[9].id || r.Items[9].ID != all[0].id {
+		t.Errorf("max_id: items %v, want the first 10 newest first", itemIDs(r.Items))
+	}
+
+	// with_ids returns the given items only
+	r = fever(t, srv, key, fmt.Sprintf("items&with_ids=%d,%d", all[3].id, news[1].id), nil)
+	if got := itemIDs(r.Items); len(got) != 2 || got[0] != all[3].id || got[1] != news[1].id {
+		t.Errorf("with_ids: items %v, want [%d %d]", got, all[3].id, news[1].id)
+	}
+}
+
+func TestFeverMarkItem(t *testing.T) {
+	c, srv, key, goArticles, _ := newFeverServer(t)
+	id := goArticles[0].id
+
+	r := fever(t, srv, key, "", url.Values{"mark": {"item"}, "as": {"read"}, "id": {strconv.Itoa(id)}})
+	if a, _ := c.Article(id); !a.read {
+		t.Errorf("article not marked read")
+	}
+	if strings.Contains(","+r.UnreadItemIDs+",", fmt.Sprintf(",%d,", id)) {
+		t.Errorf("unread_item_ids %s contains read article %d", r.UnreadItemIDs, id)
+	}
+
+	fever(t, srv, key, "", url.Values{"mark": {"item"}, "as": {"unread"}, "id": {strconv.Itoa(id)}})
+	if a, _ := c.Article(id); a.read {
+		t.Errorf("article not marked unread")
+	}
+
+	r = fever(t, srv, key, "", url.Values{"mark": {"item"}, "as": {"saved"}, "id": {strconv.Itoa(id)}})
+	if a, _ := c.Article(id); !a.starred {
+		t.Errorf("article not saved")
+	}
+	if r.SavedItemIDs != strconv.Itoa(id) {
+		t.Errorf("saved_item_ids = %q, want %d", r.SavedItemIDs, id)
+	}
+
+	fever(t, srv, key, "", url.Values{"mark": {"item"}, "as": {"unsaved"}, "id": {strconv.Itoa(id)}})
+	if a, _ := c.Article(id); a.starred {
+		t.Errorf("article not unsaved")
+	}
+}
+
+// unread returns the number of unread articles
+func unread(c *Controller, articles []*Article) int {
+	n := 0
+	for _, a := range articles {
+		if a, err := c.Article(a.id); err == nil && !a.read {
+			n++
+		}
+	}
+	return n
+}
+
+// journalEntries returns the number of changes in the journal
+func journalEntries(t *testing.T, c *Controller) int {
+	t.Helper()
+
+	var n int
+	if err := c.db.db.QueryRow("select count(*) from journal").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestFeverMarkFeed(t *testing.T) {
+	c, srv, key, goArticles, news := newFeverServer(t)
+
+	var feedID int
+	for _, f := range fever(t, srv, key, "feeds", nil).Feeds {
+		if f.URL == feverNewsFeed {
+			feedID = f.ID
+		}
+	}
+	if feedID == 0 {
+		t.Fatalf("feed %s not found", feverNewsFeed)
+	}
+
+	// Only articles published before the given time are marked
+	before := news[2].published.Unix() + 1
+	fever(t, srv, key, "", url.Values{"mark": {"feed"}, "as": {"read"}, "id": {strconv.Itoa(feedID)}, "before": {strconv.FormatInt(before, 10)}})
+	if n := unread(c, news); n != 2 {
+		t.Errorf("%d unread articles in feed, want 2", n)
+	}
+	if n := unread(c, goArticles); n != len(goArticles) {
+		t.Errorf("articles of another feed marked read")
+	}
+	if n := journalEntries(t, c); n != 1 {
+		t.Errorf("%d changes in the journal, want 1", n)
+	}
+}
+
+func TestFeverMarkGroup(t *testing.T) {
+	c, srv, key, goArticles, news := newFeverServer(t)
+
+	group := int(crc32.ChecksumIEEE([]byte("Go")) & 0x7fffffff)
+	fever(t, srv, key, "", url.Values{"mark": {"group"}, "as": {"read"}, "id": {strconv.Itoa(group)}})
+	if n := unread(c, goArticles); n != 0 {
+		t.Errorf("%d unread articles in group, want 0", n)
+	}
+	if n := unread(c, news); n != len(news) {
+		t.Errorf("articles outside of the group marked read")
+	}
+
+	// Group 0 is all feeds
+	fever(t, srv, key, "", url.Values{"mark": {"group"}, "as": {"read"}, "id": {"0"}})
+	if n := unread(c, news); n != 0 {
+		t.Errorf("%d unread articles after marking all read, want 0", n)
+	}
+
+	// Each mark is one change that can be undone
+	if n := journalEntries(t, c); n != 2 {
+		t.Errorf("%d changes in the journal, want 2", n)
+	}
+	if _, err := c.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if n := unread(c, news); n != len(news) {
+		t.Errorf("%d unread articles after undo, want %d", n, len(news))
+	}
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+)
+
+// FetchFullContent downloads the web page of an article and extracts the
+// article from it. The content is stored in the database and shown in the
+// preview instead of the content of the feed.
+func (c *Controller) FetchFullContent(a *Article) (string, error) {
+	if a.link == "" {
+		return "", fmt.Errorf("article has no link")
+	}
+
+	resp, err := c.rss.get(a.link, "", "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	content, err := Readable(resp.Body, resp.Request.URL)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", a.link, err)
+	}
+	return content, nil
+}
+
+// fetchFullContents fetches the full content of new articles of the feeds
+// with fetchFullContent set. It is run in the background after an update,
+// so a slow web page doesn't hold up the other feeds.
+func (c *Controller) fetchFullContents(articles []Article) {
+	full := make(map[string]bool)
+	for _, f := range c.Feeds() {
+		if f.FetchFullContent {
+			full[c.rss.Title(f.URL)] = true
+		}
+	}
+	if len(full) == 0 {
+		return
+	}
+
+	contents := make(map[int]string)
+	var ids []int
+	for i := range articles {
+		a := &articles[i]
+		if !full[a.feed] {
+			continue
+		}
+		content, err := c.FetchFullContent(a)
+		if err != nil {
+			log.Printf("Failed to fetch full content: %v", err)
+			continue
+		}
+		contents[a.id] = content
+		ids = append(ids, a.id)
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	err := c.changeArticles(ids, func(articles []*Article) error {
+		for _, a := range articles {
+			a.fullContent = contents[a.id]
+			if err := c.db.SetFullContent(a); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to save full content: %v", err)
+	}
+}
+
+// showFullContent fetches the full content of an article and shows it in the
+// preview.
+func (c *Controller) showFullContent(id int, link string) {
+	content, err := c.FetchFullContent(&Article{id: id, link: link})
+	if err != nil {
+		c.win.app.QueueUpdateDraw(func() {
+			c.win.StatusMessage(fmt.Sprintf("Failed to fetch full content: %v", err))
+		})
+		return
+	}
+
+	err = c.changeArticle(id, func(a *Article) error {
+		a.fullContent = content
+		return c.db.SetFullContent(a)
+	})
+	c.win.app.QueueUpdateDraw(func() {
+		if err != nil {
+			c.win.StatusMessage(fmt.Sprintf("Failed to save full content: %v", err))
+			return
+		}
+		if a := c.prevArticle; a != nil && a.id == id {
+			a.fullContent = content
+			c.win.AddPreview(a)
+		}
+		c.win.StatusMessage("Fetched full content")
+	})
+}
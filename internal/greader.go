@@ -0,0 +1,320 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Google Reader stream ids and tags
+const (
+	greaderReadingList = "user/-/state/com.google/reading-list"
+	greaderRead        = "user/-/state/com.google/read"
+	greaderStarred     = "user/-/state/com.google/starred"
+	greaderItemPrefix  = "tag:google.com,2005:reader/item/"
+)
+
+// GReader is a client for servers with the Google Reader API, such as
+// FreshRSS and Miniflux.
+type GReader struct {
+	// URL is the base of the API, e.g.
+	// https://rss.example.com/api/greader.php for FreshRSS
+	URL      string
+	Username string
+	Password string
+	Client   *http.Client
+
+	auth  string
+	token string
+}
+
+// GReaderSubscription is a feed subscribed to on the server
+type GReaderSubscription struct {
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	URL        string `json:"url"`
+	HTMLURL    string `json:"htmlUrl"`
+	Categories []struct {
+		ID    string `json:"id"`
+		Label string `json:"label"`
+	} `json:"categories"`
+}
+
+// GReaderItem is an article on the server
+type GReaderItem struct {
+	ID            string   `json:"id"`
+	Title         string   `json:"title"`
+	Author        string   `json:"author"`
+	Published     int64    `json:"published"`
+	Updated       int64    `json:"updated"`
+	TimestampUsec string   `json:"timestampUsec"`
+	Categories    []string `json:"categories"`
+	Canonical     []struct {
+		Href string `json:"href"`
+	} `json:"canonical"`
+	Alternate []struct {
+		Href string `json:"href"`
+	} `json:"alternate"`
+	Summary struct {
+		Content string `json:"content"`
+	} `json:"summary"`
+	Content struct {
+		Content string `json:"content"`
+	} `json:"content"`
+	Origin struct {
+		StreamID string `json:"streamId"`
+		Title    string `json:"title"`
+	} `json:"origin"`
+}
+
+// Link returns the link to the article on the website
+func (i *GReaderItem) Link() string {
+	if len(i.Canonical) > 0 && i.Canonical[0].Href != "" {
+		return i.Canonical[0].Href
+	}
+	if len(i.Alternate) > 0 {
+		return i.Alternate[0].Href
+	}
+	return ""
+}
+
+// HTML returns the content of the article
+func (i *GReaderItem) HTML() string {
+	if i.Content.Content != "" {
+		return i.Content.Content
+	}
+	return i.Summary.Content
+}
+
+// HasTag returns true if the item has the given tag, e.g. greaderRead
+func (i *GReaderItem) HasTag(tag string) bool {
+	for _, c := range i.Categories {
+		// The user id may be given instead of -
+		if c == tag || strings.HasSuffix(c, strings.TrimPrefix(tag, "user/-")) && strings.HasPrefix(c, "user/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Modified returns the last time the item was changed on the server
+func (i *GReaderItem) Modified() time.Time {
+	if usec, err := strconv.ParseInt(i.TimestampUsec, 10, 64); err == nil && usec > 0 {
+		return time.UnixMicro(usec).UTC()
+	}
+	if i.Updated > 0 {
+		return time.Unix(i.Updated, 0).UTC()
+	}
+	return time.Unix(i.Published, 0).UTC()
+}
+
+// Login authenticates with ClientLogin and gets a token for changes
+func (g *GReader) Login() error {
+	form := url.Values{"Email": {g.Username}, "Passwd": {g.Password}}
+	resp, err := g.client().PostForm(g.URL+"/accounts/ClientLogin", form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("login to %s failed: %s", g.URL, resp.Status)
+	}
+
+	g.auth = ""
+	s := bufio.NewScanner(resp.Body)
+	for s.Scan() {
+		if strings.HasPrefix(s.Text(), "Auth=") {
+			g.auth = strings.TrimPrefix(s.Text(), "Auth=")
+		}
+	}
+	if g.auth == "" {
+		return fmt.Errorf("login to %s failed: no auth token", g.URL)
+	}
+
+	body, err := g.do("GET", "/reader/api/0/token", nil)
+	if err != nil {
+		return err
+	}
+	g.token = strings.TrimSpace(string(body))
+	return nil
+}
+
+// Subscriptions returns the feeds subscribed to on the server
+func (g *GReader) Subscriptions() ([]GReaderSubscription, error) {
+	body, err := g.do("GET", "/reader/api/0/subscription/list?output=json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Subscriptions []GReaderSubscription `json:"subscriptions"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("invalid subscription list: %v", err)
+	}
+	return list.Subscriptions, nil
+}
+
+// ItemIDs returns the ids of the items of a stream, optionally excluding the
+// items with a tag and only those newer than since.
+func (g *GReader) ItemIDs(stream, exclude string, since time.Time) ([]string, error) {
+	var ids []string
+	cont := ""
+	for {
+		q := url.Values{"output": {"json"}, "s": {stream}, "n": {"10000"}}
+		if exclude != "" {
+			q.Set("xt", exclude)
+		}
+		if !since.IsZero() {
+			q.Set("ot", strconv.FormatInt(since.Unix(), 10))
+		}
+		if cont != "" {
+			q.Set("c", cont)
+		}
+
+		body, err := g.do("GET", "/reader/api/0/stream/items/ids?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var refs struct {
+			ItemRefs []struct {
+				ID string `json:"id"`
+			} `json:"itemRefs"`
+			Continuation string `json:"continuation"`
+		}
+		if err := json.Unmarshal(body, &refs); err != nil {
+			return nil, fmt.Errorf("invalid item ids: %v", err)
+		}
+		for _, r := range refs.ItemRefs {
+			ids = append(ids, GReaderItemID(r.ID))
+		}
+
+		if refs.Continuation == "" || refs.Continuation == cont || len(refs.ItemRefs) == 0 {
+			return ids, nil
+		}
+		cont = refs.Continuation
+	}
+}
+
+// Items returns the items with the given ids
+func (g *GReader) Items(ids []string) ([]GReaderItem, error) {
+	var items []GReaderItem
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > 250 {
+			n = 250
+		}
+
+		form := url.Values{"i": ids[:n]}
+		body, err := g.do("POST", "/reader/api/0/stream/items/contents?output=json", form)
+		if err != nil {
+			return nil, err
+		}
+
+		var contents struct {
+			Items []GReaderItem `json:"items"`
+		}
+		if err := json.Unmarshal(body, &contents); err != nil {
+			return nil, fmt.Errorf("invalid items: %v", err)
+		}
+		for i := range contents.Items {
+			contents.Items[i].ID = GReaderItemID(contents.Items[i].ID)
+		}
+		items = append(items, contents.Items...)
+		ids = ids[n:]
+	}
+	return items, nil
+}
+
+// EditTag adds or removes a tag, e.g. greaderRead, on items
+func (g *GReader) EditTag(ids []string, tag string, add bool) error {
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > 250 {
+			n = 250
+		}
+
+		form := url.Values{"i": ids[:n]}
+		if add {
+			form.Set("a", tag)
+		} else {
+			form.Set("r", tag)
+		}
+		if _, err := g.do("POST", "/reader/api/0/edit-tag", form); err != nil {
+			return err
+		}
+		ids = ids[n:]
+	}
+	return nil
+}
+
+// GReaderItemID returns the long form of an item id. Item ids are given
+// either as decimal numbers or as tag:google.com,2005:reader/item/<hex>.
+func GReaderItemID(id string) string {
+	if strings.HasPrefix(id, greaderItemPrefix) {
+		return id
+	}
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return fmt.Sprintf("%s%016x", greaderItemPrefix, uint64(n))
+	}
+	return id
+}
+
+// do sends an authenticated request and returns the body of the response.
+// The request is retried once after logging in again if the session has
+// expired.
+func (g *GReader) do(method, path string, form url.Values) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		if form != nil && g.token != "" {
+			form.Set("T", g.token)
+		}
+
+		var body io.Reader
+		if form != nil {
+			body = strings.NewReader(form.Encode())
+		}
+		req, err := http.NewRequest(method, g.URL+path, body)
+		if err != nil {
+			return nil, err
+		}
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		req.Header.Set("Authorization", "GoogleLogin auth="+g.auth)
+
+		resp, err := g.client().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 && path != "/reader/api/0/token" {
+			if err := g.Login(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+		return b, nil
+	}
+}
+
+func (g *GReader) client() *http.Client {
+	if g.Client == nil {
+		g.Client = &http.Client{Timeout: time.Minute}
+	}
+	return g.Client
+}
@@ -0,0 +1,562 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeItem is an item on the fake GReader server
+type fakeItem struct {
+	id        int64
+	feed      string
+	title     string
+	link      string
+	published time.Time
+	// modified is when the item or its tags last changed
+	modified time.Time
+}
+
+// fakeGReader is a GReader server with one user, serving the parts of the
+// API used by gorss. Item ids are given out as decimal numbers, in pages of
+// pageSize items.
+type fakeGReader struct {
+	mu       sync.Mutex
+	auth     string
+	pageSize int
+	subs     []GReaderSubscription
+	items    []fakeItem
+	tags     map[string]map[int64]bool
+	edits    int
+}
+
+func newFakeGReader(t *testing.T) (*fakeGReader, *httptest.Server) {
+	f := &fakeGReader{
+		auth:     "auth-1",
+		pageSize: 2,
+		tags:     map[string]map[int64]bool{greaderRead: {}, greaderStarred: {}},
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+// addItem adds an item to the server, published an hour ago
+func (f *fakeGReader) addItem(feed, title, link string) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := int64(len(f.items) + 1)
+	published := time.Now().Add(-time.Hour)
+	f.items = append(f.items, fakeItem{id: id, feed: feed, title: title, link: link, published: published, modified: published})
+	return id
+}
+
+// setTag adds or removes a tag on an item and updates when it was modified
+func (f *fakeGReader) setTag(id int64, tag string, on bool) {
+	if on {
+		f.tags[tag][id] = true
+	} else {
+		delete(f.tags[tag], id)
+	}
+	for i := range f.items {
+		if f.items[i].id == id {
+			f.items[i].modified = time.Now()
+		}
+	}
+}
+
+// tag adds or removes a tag on an item, as another client would
+func (f *fakeGReader) tag(id int64, tag string, on bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setTag(id, tag, on)
+}
+
+func (f *fakeGReader) hasTag(id int64, tag string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.tags[tag][id]
+}
+
+func (f *fakeGReader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/accounts/ClientLogin" {
+		r.ParseForm()
+		if r.PostForm.Get("Email") != "user" || r.PostForm.Get("Passwd") != "secret" {
+			http.Error(w, "Error=BadAuthentication", http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, "SID=sid\nLSID=lsid\nAuth=%s\n", f.auth)
+		return
+	}
+	if r.Header.Get("Authorization") != "GoogleLogin auth="+f.auth {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/reader/api/0/token":
+		fmt.Fprint(w, "token-1")
+	case "/reader/api/0/subscription/list":
+		json.NewEncoder(w).Encode(map[string]interface{}{"subscriptions": f.subs})
+	case "/reader/api/0/stream/items/ids":
+		f.itemIDs(w, r.URL.Query())
+	case "/reader/api/0/stream/items/contents":
+		r.ParseForm()
+		f.contents(w, r.PostForm["i"])
+	case "/reader/api/0/edit-tag":
+		r.ParseForm()
+		if r.PostForm.Get("T") != "token-1" {
+			http.Error(w, "invalid token", http.StatusBadRequest)
+			return
+		}
+		f.edits++
+		for _, i := range r.PostForm["i"] {
+			id := fakeID(i)
+			if a := r.PostForm.Get("a"); a != "" {
+				f.setTag(id, a, true)
+			}
+			if rm := r.PostForm.Get("r"); rm != "" {
+				f.setTag(id, rm, false)
+			}
+		}
+		fmt.Fprint(w, "OK")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeGReader) itemIDs(w http.ResponseWriter, q url.Values) {
+	var ids []int64
+	for _, it := range f.items {
+		switch q.Get("s") {
+		case greaderReadingList:
+		case greaderStarred:
+			if !f.tags[greaderStarred][it.id] {
+				continue
+			}
+		default:
+			continue
+		}
+		if xt := q.Get("xt"); xt != "" && f.tags[xt][it.id] {
+			continue
+		}
+		if ot, err := strconv.ParseInt(q.Get("ot"), 10, 64); err == nil && it.published.Unix() < ot {
+			continue
+		}
+		ids = append(ids, it.id)
+	}
+
+	start, _ := strconv.Atoi(q.Get("c"))
+	end := start + f.pageSize
+	cont := strconv.Itoa(end)
+	if end >= len(ids) {
+		end = len(ids)
+		cont = ""
+	}
+
+	refs := []map[string]string{}
+	for _, id := range ids[start:end] {
+		refs = append(refs, map[string]string{"id": strconv.FormatInt(id, 10)})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"itemRefs": refs, "continuation": cont})
+}
+
+func (f *fakeGReader) contents(w http.ResponseWriter, ids []string) {
+	items := []map[string]interface{}{}
+	for _, i := range ids {
+		id := fakeID(i)
+		for _, it := range f.items {
+			if it.id != id {
+				continue
+			}
+			categories := []string{greaderReadingList}
+			for tag, ids := range f.tags {
+				if ids[id] {
+					categories = append(categories, tag)
+				}
+			}
+			items = append(items, map[string]interface{}{
+				"id":            fmt.Sprintf("%s%016x", greaderItemPrefix, id),
+				"title":         it.title,
+				"author":        "Jane Doe",
+				"published":     it.published.Unix(),
+				"timestampUsec": strconv.FormatInt(it.modified.UnixMicro(), 10),
+				"categories":    categories,
+				"canonical":     []map[string]string{{"href": it.link}},
+				"summary":       map[string]string{"content": "<p>" + it.title + "</p>"},
+				"origin":        map[string]string{"streamId": "feed/" + it.feed, "title": "Server title"},
+			})
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+}
+
+// fakeID returns the number of a long form item id
+func fakeID(id string) int64 {
+	n, _ := strconv.ParseUint(strings.TrimPrefix(GReaderItemID(id), greaderItemPrefix), 16, 64)
+	return int64(n)
+}
+
+func TestGReaderLogin(t *testing.T) {
+	_, srv := newFakeGReader(t)
+
+	g := &GReader{URL: srv.URL, Username: "user", Password: "secret"}
+	if err := g.Login(); err != nil {
+		t.Fatal(err)
+	}
+	if g.auth != "auth-1" || g.token != "token-1" {
+		t.Errorf("auth %q and token %q, want auth-1 and token-1", g.auth, g.token)
+	}
+
+	g = &GReader{URL: srv.URL, Username: "user", Password: "wrong"}
+	if err := g.Login(); err == nil {
+		t.Errorf("login with a wrong password succeeded")
+	}
+}
+
+func TestGReaderRelogin(t *testing.T) {
+	f, srv := newFakeGReader(t)
+
+	g := &GReader{URL: srv.URL, Username: "user", Password: "secret"}
+	if err := g.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The session expires, the client logs in again
+	f.mu.Lock()
+	f.auth = "auth-2"
+	f.mu.Unlock()
+	if _, err := g.Subscriptions(); err != nil {
+		t.Fatal(err)
+	}
+	if g.auth != "auth-2" {
+		t.Errorf("auth %q, want auth-2", g.auth)
+	}
+}
+
+func TestGReaderItemIDs(t *testing.T) {
+	f, srv := newFakeGReader(t)
+	for i := 1; i <= 5; i++ {
+		f.addItem("https://a.example.com/feed", fmt.Sprintf("Item %d", i), fmt.Sprintf("https://a.example.com/%d", i))
+	}
+	f.tag(2, greaderRead, true)
+	f.tag(4, greaderStarred, true)
+
+	g := &GReader{URL: srv.URL, Username: "user", Password: "secret"}
+	if err := g.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		stream  string
+		exclude string
+		since   time.Time
+		want    []int64
+	}{
+		{"all, over several pages", greaderReadingList, "", time.Time{}, []int64{1, 2, 3, 4, 5}},
+		{"unread", greaderReadingList, greaderRead, time.Time{}, []int64{1, 3, 4, 5}},
+		{"starred", greaderStarred, "", time.Time{}, []int64{4}},
+		{"newer than since", greaderReadingList, "", time.Now(), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, err := g.ItemIDs(tt.stream, tt.exclude, tt.since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int64
+			for _, id := range ids {
+				if !strings.HasPrefix(id, greaderItemPrefix) {
+					t.Errorf("id %s is not in the long form", id)
+				}
+				got = append(got, fakeID(id))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGReaderItems(t *testing.T) {
+	f, srv := newFakeGReader(t)
+	f.addItem("https://a.example.com/feed", "First", "https://a.example.com/1")
+	f.addItem("https://a.example.com/feed", "Second", "https://a.example.com/2")
+	f.tag(2, greaderRead, true)
+
+	g := &GReader{URL: srv.URL, Username: "user", Password: "secret"}
+	if err := g.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := g.Items([]string{"2", fmt.Sprintf("%s%016x", greaderItemPrefix, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+
+	first := items[0]
+	if first.ID != GReaderItemID("1") || first.Title != "First" || first.Author != "Jane Doe" {
+		t.Errorf("item %+v, want First", first)
+	}
+	if first.Link() != "https://a.example.com/1" || first.HTML() != "<p>First</p>" {
+		t.Errorf("link %q and content %q of First", first.Link(), first.HTML())
+	}
+	if first.Modified().IsZero() || first.HasTag(greaderRead) {
+		t.Errorf("First has no modification time or is read")
+	}
+	if !items[1].HasTag(greaderRead) {
+		t.Errorf("Second isn't read")
+	}
+}
+
+func TestGReaderEditTag(t *testing.T) {
+	f, srv := newFakeGReader(t)
+	f.addItem("https://a.example.com/feed", "First", "https://a.example.com/1")
+
+	g := &GReader{URL: srv.URL, Username: "user", Password: "secret"}
+	if err := g.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.EditTag([]string{GReaderItemID("1")}, greaderRead, true); err != nil {
+		t.Fatal(err)
+	}
+	if !f.hasTag(1, greaderRead) {
+		t.Errorf("item not marked read")
+	}
+	if err := g.EditTag([]string{GReaderItemID("1")}, greaderRead, false); err != nil {
+		t.Fatal(err)
+	}
+	if f.hasTag(1, greaderRead) {
+		t.Errorf("item not marked unread")
+	}
+
+	// Nothing is sent without items
+	edits := f.edits
+	if err := g.EditTag(nil, greaderStarred, true); err != nil {
+		t.Fatal(err)
+	}
+	if f.edits != edits {
+		t.Errorf("edit-tag sent without items")
+	}
+}
+
+// newSyncController returns a controller that syncs with a fake server
+func newSyncController(t *testing.T, srv *httptest.Server, feeds string) *Controller {
+	return newTestController(t, fmt.Sprintf(`{
+		"feeds": [%s],
+		"skipArticlesOlderThanDays": 7,
+		"greader": {"url": %q, "username": "user", "password": "secret"}
+	}`, feeds, srv.URL))
+}
+
+// syncedArticle returns the stored article with a remote id
+func syncedArticle(t *testing.T, c *Controller, id int64) *Article {
+	t.Helper()
+	for _, a := range c.db.syncArticles() {
+		if a.remoteID == GReaderItemID(strconv.FormatInt(id, 10)) {
+			article, err := c.Article(a.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return article
+		}
+	}
+	t.Fatalf("item %d not synced", id)
+	return nil
+}
+
+// syncNow syncs and waits a moment, so that changes made after it are newer
+// than the last sync.
+func syncNow(t *testing.T, c *Controller) int {
+	t.Helper()
+	news, err := c.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	return news
+}
+
+func TestSyncPull(t *testing.T) {
+	f, srv := newFakeGReader(t)
+	f.subs = []GReaderSubscription{{ID: "feed/https://a.example.com/feed", Title: "A", URL: "https://a.example.com/feed"}}
+	for i := 1; i <= 3; i++ {
+		f.addItem("https://a.example.com/feed", fmt.Sprintf("Item %d", i), fmt.Sprintf("https://a.example.com/%d", i))
+	}
+	f.tag(2, greaderRead, true)
+	f.tag(2, greaderStarred, true)
+
+	c := newSyncController(t, srv, "")
+	if news := syncNow(t, c); news != 3 {
+		t.Errorf("%d new articles, want 3", news)
+	}
+
+	a := syncedArticle(t, c, 2)
+	if !a.read || !a.starred || a.feed != "A" || a.link != "https://a.example.com/2" {
+		t.Errorf("article %+v doesn't match item 2", a)
+	}
+	if a := syncedArticle(t, c, 1); a.read || a.starred {
+		t.Errorf("item 1 is read or starred")
+	}
+
+	// Changes made on the server are applied
+	f.tag(1, greaderRead, true)
+	f.tag(2, greaderStarred, false)
+	if news := syncNow(t, c); news != 0 {
+		t.Errorf("%d new articles, want 0", news)
+	}
+	if a := syncedArticle(t, c, 1); !a.read {
+		t.Errorf("item 1 not read after sync")
+	}
+	if a := syncedArticle(t, c, 2); a.starred {
+		t.Errorf("item 2 still starred after sync")
+	}
+
+	// Remote feeds are listed, but not fetched
+	var remote bool
+	for _, feed := range c.Feeds() {
+		if feed.URL == "https://a.example.com/feed" {
+			remote = feed.Remote
+		}
+	}
+	if !remote {
+		t.Errorf("subscription isn't a remote feed")
+	}
+}
+
+func TestSyncPush(t *testing.T) {
+	f, srv := newFakeGReader(t)
+	f.subs = []GReaderSubscription{{ID: "feed/https://a.example.com/feed", Title: "A", URL: "https://a.example.com/feed"}}
+	f.addItem("https://a.example.com/feed", "First", "https://a.example.com/1")
+	f.addItem("https://a.example.com/feed", "Second", "https://a.example.com/2")
+	f.tag(2, greaderRead, true)
+
+	c := newSyncController(t, srv, "")
+	syncNow(t, c)
+
+	if err := c.SetArticleRead(syncedArticle(t, c, 1).id, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetArticleRead(syncedArticle(t, c, 2).id, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetArticleStarred(syncedArticle(t, c, 2).id, true); err != nil {
+		t.Fatal(err)
+	}
+	syncNow(t, c)
+
+	if !f.hasTag(1, greaderRead) {
+		t.Errorf("read not pushed")
+	}
+	if f.hasTag(2, greaderRead) {
+		t.Errorf("unread not pushed")
+	}
+	if !f.hasTag(2, greaderStarred) {
+		t.Errorf("star not pushed")
+	}
+
+	// Nothing is pushed when nothing changed
+	edits := f.edits
+	syncNow(t, c)
+	if f.edits != edits {
+		t.Errorf("%d changes pushed without local changes", f.edits-edits)
+	}
+}
+
+func TestSyncConflict(t *testing.T) {
+	f, srv := newFakeGReader(t)
+	f.subs = []GReaderSubscription{{ID: "feed/https://a.example.com/feed", Title: "A", URL: "https://a.example.com/feed"}}
+	f.addItem("https://a.example.com/feed", "First", "https://a.example.com/1")
+	f.addItem("https://a.example.com/feed", "Second", "https://a.example.com/2")
+	f.addItem("https://a.example.com/feed", "Third", "https://a.example.com/3")
+
+	c := newSyncController(t, srv, "")
+	syncNow(t, c)
+
+	// Item 1 is read on the server and starred locally, both are kept.
+	// Item 2 is starred on the server and read locally, then starred and
+	// unstarred locally, the newer local change wins.
+	f.tag(1, greaderRead, true)
+	f.tag(2, greaderStarred, true)
+	time.Sleep(10 * time.Millisecond)
+	c.SetArticleStarred(syncedArticle(t, c, 1).id, true)
+	c.SetArticleRead(syncedArticle(t, c, 2).id, true)
+	c.SetArticleStarred(syncedArticle(t, c, 2).id, true)
+	c.SetArticleStarred(syncedArticle(t, c, 2).id, false)
+
+	// Item 3 is starred locally, then starred and unstarred on the server,
+	// the newer server change wins.
+	c.SetArticleStarred(syncedArticle(t, c, 3).id, true)
+	time.Sleep(10 * time.Millisecond)
+	f.tag(3, greaderStarred, true)
+	f.tag(3, greaderStarred, false)
+	syncNow(t, c)
+
+	if a := syncedArticle(t, c, 1); !a.read || !a.starred {
+		t.Errorf("item 1: read %v starred %v, want both", a.read, a.starred)
+	}
+	if !f.hasTag(1, greaderRead) || !f.hasTag(1, greaderStarred) {
+		t.Errorf("item 1 on the server isn't read and starred")
+	}
+	if a := syncedArticle(t, c, 2); !a.read || a.starred {
+		t.Errorf("item 2: read %v starred %v, want read and not starred", a.read, a.starred)
+	}
+	if !f.hasTag(2, greaderRead) || f.hasTag(2, greaderStarred) {
+		t.Errorf("item 2 on the server isn't read and unstarred")
+	}
+	if a := syncedArticle(t, c, 3); a.starred {
+		t.Errorf("item 3 is starred, want the server change")
+	}
+	if f.hasTag(3, greaderStarred) {
+		t.Errorf("item 3 starred on the server")
+	}
+}
+
+func TestSyncLocalFeed(t *testing.T) {
+	f, srv := newFakeGReader(t)
+	const feedURL = "https://a.example.com/feed"
+	f.subs = []GReaderSubscription{{ID: "feed/" + feedURL, Title: "Server title", URL: feedURL}}
+	f.addItem(feedURL, "First", "https://a.example.com/1")
+
+	// The feed is in the configuration too and has been fetched
+	c := newSyncController(t, srv, fmt.Sprintf("%q", feedURL))
+	addTestFeed(c, feedURL, "A")
+	local := &Article{c: c, feed: "A", guid: "urn:uuid:1", title: "First", link: "https://a.example.com/1", published: time.Now()}
+	if _, err := c.db.Save(local); err != nil {
+		t.Fatal(err)
+	}
+
+	if news := syncNow(t, c); news != 0 {
+		t.Errorf("%d new articles, want 0", news)
+	}
+	if n := len(c.db.All()); n != 1 {
+		t.Errorf("%d articles stored, want 1", n)
+	}
+	if a := syncedArticle(t, c, 1); a.id != local.id {
+		t.Errorf("item synced to article %d, want %d", a.id, local.id)
+	}
+
+	// Locally fetched feeds aren't remote feeds
+	for _, feed := range c.Feeds() {
+		if feed.Remote {
+			t.Errorf("feed %s is remote", feed.URL)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestController returns a controller without a window, with the given
+// configuration and an empty database in a temporary directory.
+func newTestController(t *testing.T, conf string) *Controller {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := filepath.Join(dir, "gorss.conf")
+	if err := os.WriteFile(cfg, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Controller{}
+	c.Setup(cfg, filepath.Join(dir, "gorss.db"))
+	t.Cleanup(func() { c.db.db.Close() })
+	return c
+}
+
+// addTestFeed stores a feed as if it had been fetched
+func addTestFeed(c *Controller, url, title string) {
+	c.db.SaveFeedCache(url, title, url+"/site", "", "")
+	c.rss.tLock.Lock()
+	c.rss.titles[url] = title
+	c.rss.tLock.Unlock()
+}
+
+// addTestArticles stores n articles in a feed, published a minute apart
+func addTestArticles(t *testing.T, c *Controller, feed string, n int) []*Article {
+	t.Helper()
+
+	var articles []*Article
+	start := time.Now().Add(-time.Duration(n) * time.Minute)
+	for i := 0; i < n; i++ {
+		a := &Article{
+			c:         c,
+			feed:      feed,
+			guid:      fmt.Sprintf("%s-%d", feed, i),
+			title:     fmt.Sprintf("%s article %d", feed, i),
+			content:   fmt.Sprintf("<p>Content %d</p>", i),
+			link:      fmt.Sprintf("https://example.com/%s/%d", feed, i),
+			author:    "Jane Doe",
+			published: start.Add(time.Duration(i) * time.Minute),
+		}
+		if _, err := c.db.Save(a); err != nil {
+			t.Fatal(err)
+		}
+		articles = append(articles, a)
+	}
+	return articles
+}
@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// highlightAttrs are the text attributes of highlights, as tview style tags
+var highlightAttrs = map[string]string{
+	"bold":      "b",
+	"italic":    "i",
+	"underline": "u",
+	"reverse":   "r",
+	"blink":     "l",
+	"dim":       "d",
+}
+
+// Highlight marks articles with matching titles. In the configuration a
+// highlight is either a word, matched anywhere in the words of titles, or
+// an object.
+type Highlight struct {
+	// Word is matched in titles ignoring case
+	Word string `json:"word"`
+	// Match is a regular expression matched against titles
+	Match string `json:"match"`
+	// WholeWord only matches Word or Match as whole words
+	WholeWord bool `json:"wholeWord"`
+	// Content matches the content of articles as well
+	Content bool `json:"content"`
+	// Feeds limits the highlight to feeds with these titles, names, URLs or
+	// categories.
+	Feeds []string `json:"feeds"`
+	// Color is a color, or the name of a color of the theme, default the
+	// highlights color of the theme.
+	Color string `json:"color"`
+	// Attr is bold, italic, underline, reverse, blink or dim
+	Attr string `json:"attr"`
+	// Priority decides which highlight is shown when several match the
+	// same text, the highest wins.
+	Priority int `json:"priority"`
+
+	re *regexp.Regexp
+}
+
+// UnmarshalJSON reads a highlight from either a word or an object
+func (h *Highlight) UnmarshalJSON(b []byte) error {
+	var word string
+	if err := json.Unmarshal(b, &word); err == nil {
+		*h = Highlight{Word: word}
+		return nil
+	}
+	type highlight Highlight
+	return json.Unmarshal(b, (*highlight)(h))
+}
+
+// compile checks the highlight and compiles its regular expression
+func (h *Highlight) compile() error {
+	var expr string
+	switch {
+	case h.Word != "" && h.Match != "":
+		return fmt.Errorf("a highlight has either word or match")
+	case h.Word != "" && h.WholeWord:
+		expr = `(?i)\b` + regexp.QuoteMeta(h.Word) + `\b`
+	case h.Word != "":
+		// The whole word containing the text is highlighted
+		expr = `(?i)\S*` + regexp.QuoteMeta(h.Word) + `\S*`
+	case h.Match != "" && h.WholeWord:
+		expr = `\b(?:` + h.Match + `)\b`
+	case h.Match != "":
+		expr = h.Match
+	default:
+		return fmt.Errorf("a highlight needs word or match")
+	}
+	if _, ok := highlightAttrs[h.Attr]; h.Attr != "" && !ok {
+		return fmt.Errorf("invalid attr %q", h.Attr)
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid match %q: %v", h.Match, err)
+	}
+	h.re = re
+	return nil
+}
+
+// String returns the word or regular expression of the highlight
+func (h *Highlight) String() string {
+	if h.Word != "" {
+		return h.Word
+	}
+	return h.Match
+}
+
+// highlightSpan is a part of a title matched by a highlight
+type highlightSpan struct {
+	start, end int
+	h          *Highlight
+}
+
+// highlights returns the highlights matching an article, highest priority
+// first.
+func (c *Controller) highlights(a *Article) []*Highlight {
+	var matches []*Highlight
+	for i := range c.conf.Highlights {
+		h := &c.conf.Highlights[i]
+		if len(h.Feeds) > 0 && !c.matchesFeed(h.Feeds, a) {
+			continue
+		}
+		if h.re.MatchString(a.title) || (h.Content && h.re.MatchString(a.content)) {
+			matches = append(matches, h)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Priority > matches[j].Priority })
+	return matches
+}
+
+// isHighlight returns true if an article is highlighted, either by a rule or
+// by any of the highlights.
+func (c *Controller) isHighlight(a *Article) bool {
+	return a.color != "" || len(c.highlights(a)) > 0
+}
+
+// highlightTitle returns the title of an article with the highlighted parts
+// in their colors, as tview style tags. Where highlights overlap the one
+// with the highest priority is shown.
+func (c *Controller) highlightTitle(a *Article) string {
+	if a.color != "" {
+		// Highlighted by a rule
+		return fmt.Sprintf("[%s]%s", c.theme.color(a.color), tview.Escape(a.title))
+	}
+	matches := c.highlights(a)
+	if len(matches) == 0 {
+		return tview.Escape(a.title)
+	}
+
+	var spans []highlightSpan
+	for _, h := range matches {
+		for _, m := range h.re.FindAllStringIndex(a.title, -1) {
+			if m[0] == m[1] {
+				continue
+			}
+			overlaps := false
+			for _, s := range spans {
+				if m[0] < s.end && s.start < m[1] {
+					overlaps = true
+					break
+				}
+			}
+			if !overlaps {
+				spans = append(spans, highlightSpan{m[0], m[1], h})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		// Only the content matches, show the whole title highlighted
+		spans = append(spans, highlightSpan{0, len(a.title), matches[0]})
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var b strings.Builder
+	pos := 0
+	for _, s := range spans {
+		b.WriteString(tview.Escape(a.title[pos:s.start]))
+		b.WriteString(c.highlightStyle(s.h))
+		b.WriteString(tview.Escape(a.title[s.start:s.end]))
+		fmt.Fprintf(&b, "[%s::-]", c.theme.Title)
+		pos = s.end
+	}
+	b.WriteString(tview.Escape(a.title[pos:]))
+	return b.String()
+}
+
+// highlightStyle returns the tview style tag of a highlight
+func (c *Controller) highlightStyle(h *Highlight) string {
+	color := c.theme.Highlights
+	if h.Color != "" {
+		color = c.theme.color(h.Color)
+	}
+	return fmt.Sprintf("[%s::%s]", color, highlightAttrs[h.Attr])
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Hook posts new articles as JSON to a URL, or runs a command with the
+// articles as JSON on stdin. Without filters a hook runs for all new
+// articles. With Batch set a hook runs once per update with an array of
+// the new articles, otherwise once per article.
+type Hook struct {
+	URL     string `json:"url"`
+	Command string `json:"command"`
+	// Feeds limits the hook to feeds with these titles, names, URLs or
+	// categories.
+	Feeds []string `json:"feeds"`
+	// Highlight limits the hook to articles matching the highlights
+	Highlight bool `json:"highlight"`
+	// Match limits the hook to articles with a title or content matching
+	// this regular expression.
+	Match string `json:"match"`
+	Batch bool   `json:"batch"`
+
+	re *regexp.Regexp
+}
+
+// hookClient is used to post to hook URLs
+var hookClient = &http.Client{Timeout: 30 * time.Second}
+
+// compile checks the hook and compiles its regular expression
+func (h *Hook) compile() error {
+	if (h.URL == "") == (h.Command == "") {
+		return fmt.Errorf("a hook needs either url or command")
+	}
+	if h.Match != "" {
+		re, err := regexp.Compile(h.Match)
+		if err != nil {
+			return fmt.Errorf("invalid match %q: %v", h.Match, err)
+		}
+		h.re = re
+	}
+	return nil
+}
+
+// runHooks runs all hooks for new articles
+func (c *Controller) runHooks(articles []Article) {
+	if len(articles) == 0 {
+		return
+	}
+
+	for i := range c.conf.Hooks {
+		h := &c.conf.Hooks[i]
+
+		var matching []Article
+		for _, a := range articles {
+			if c.hookMatches(h, &a) {
+				matching = append(matching, a)
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+
+		if h.Batch {
+			c.runHook(h, matching)
+			continue
+		}
+		for _, a := range matching {
+			c.runHook(h, a)
+		}
+	}
+}
+
+// hookMatches returns true if a hook should run for an article
+func (c *Controller) hookMatches(h *Hook, a *Article) bool {
+	if len(h.Feeds) > 0 && !c.matchesFeed(h.Feeds, a) {
+		return false
+	}
+	if h.Highlight && !a.highlight {
+		return false
+	}
+	if h.re != nil && !h.re.MatchString(a.title) && !h.re.MatchString(a.content) {
+		return false
+	}
+	return true
+}
+
+// runHook posts or pipes an article, or an array of articles, as JSON
+func (c *Controller) runHook(h *Hook, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to encode articles for hook: %v", err)
+		return
+	}
+
+	if h.URL != "" {
+		resp, err := hookClient.Post(h.URL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("Hook %s failed: %v", h.URL, err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			log.Printf("Hook %s failed: %s", h.URL, resp.Status)
+		}
+		return
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", h.Command)
+	cmd.Stdin = bytes.NewReader(body)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		log.Printf("Hook %q failed: %v: %s", h.Command, err, strings.TrimSpace(string(out)))
+	}
+}
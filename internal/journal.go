@@ -0,0 +1,322 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// journalSize is the number of changes kept in the journal
+const journalSize = 500
+
+// journalAction is a change of articles that can be undone and redone
+type journalAction struct {
+	// filter selects the articles the change would make a difference to
+	filter string
+	// set changes the articles
+	set string
+	// read is true if the change is to the read state, i.e. read_changed
+	// is updated for syncing.
+	read bool
+	// browse is true for reading by moving the selection onto an article.
+	// It doesn't clear the changes that can be redone, and the journal keeps
+	// journalSize of them besides the other changes.
+	browse bool
+}
+
+// journalActions are the changes recorded in the journal, by name
+var journalActions = map[string]journalAction{
+	"read":   {"read != true", "read = true", true, false},
+	"select": {"read != true", "read = true", true, true},
+	"unread": {"read != false", "read = false", true, false},
+	"delete": {"deleted != true", "deleted = true", false, false},
+}
+
+// condition is a where clause with its arguments
+type condition struct {
+	where string
+	args  []interface{}
+}
+
+// change applies an action to the articles matching a condition and records
+// the change in the journal, with the state of the articles before it, so
+// that it can be undone. Changes that have been undone can no longer be
+// redone after a new change, unless it is a read by selection. The number of
+// changed articles is returned.
+func (d *DB) change(action, description, where string, args ...interface{}) (int, error) {
+	return d.changeWhere(action, description, []condition{{where, args}})
+}
+
+// changeIDs is change for the articles with the given ids, which are
+// selected in batches to stay below the variable limit of SQLite.
+func (d *DB) changeIDs(action, description string, ids []int) (int, error) {
+	var conds []condition
+	for _, b := range batches(ids) {
+		conds = append(conds, condition{"id in " + b.in, b.args})
+	}
+	return d.changeWhere(action, description, conds)
+}
+
+// changeWhere is change for the articles matching any of the conditions,
+// recorded as one change in the journal.
+func (d *DB) changeWhere(action, description string, conds []condition) (int, error) {
+	ja := journalActions[action]
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	type before struct {
+		id            int
+		read, deleted bool
+	}
+	var articles []before
+	for _, cond := range conds {
+		rows, err := tx.Query(fmt.Sprintf("select id, coalesce(read, false), coalesce(deleted, false) from articles where (%s) and %s", cond.where, ja.filter), cond.args...)
+		if err != nil {
+			log.Println(err)
+			return 0, err
+		}
+		for rows.Next() {
+			var b before
+			if err := rows.Scan(&b.id, &b.read, &b.deleted); err != nil {
+				rows.Close()
+				log.Println(err)
+				return 0, err
+			}
+			articles = append(articles, b)
+		}
+		rows.Close()
+	}
+	if len(articles) == 0 {
+		return 0, nil
+	}
+
+	if !ja.browse {
+		for _, stmt := range []string{
+			"delete from journal_articles where entry_id in (select id from journal where undone = true)",
+			"delete from journal where undone = true",
+		} {
+			if _, err := tx.Exec(stmt); err != nil {
+				log.Println(err)
+				return 0, err
+			}
+		}
+	}
+
+	res, err := tx.Exec("insert into journal(time, action, description) values(?, ?, ?)", time.Now().UTC(), action, description)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	entry, err := res.LastInsertId()
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	st, err := tx.Prepare("insert into journal_articles(entry_id, article_id, read, deleted) values(?, ?, ?, ?)")
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer st.Close()
+
+	for _, b := range articles {
+		if _, err := st.Exec(entry, b.id, b.read, b.deleted); err != nil {
+			log.Println(err)
+			return 0, err
+		}
+	}
+
+	if err := d.apply(tx, ja, int(entry)); err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	if action == "delete" {
+		ids := make([]int, len(articles))
+		for i, b := range articles {
+			ids[i] = b.id
+		}
+		d.unindex(ids...)
+	}
+	return len(articles), nil
+}
+
+// apply applies an action to the articles of a journal entry
+func (d *DB) apply(tx *sql.Tx, ja journalAction, entry int) error {
+	set, args := ja.set, []interface{}{}
+	if ja.read {
+		set += ", read_changed = ?"
+		args = append(args, time.Now().UTC())
+	}
+	args = append(args, entry)
+	_, err := tx.Exec("update articles set "+set+" where id in (select article_id from journal_articles where entry_id = ?)", args...)
+	return err
+}
+
+// Undo restores the articles of the last change in the journal to their
+// state before it. The description of the change is returned, or an empty
+// string if there is nothing to undo.
+func (d *DB) Undo() (string, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var (
+		entry               int
+		action, description string
+	)
+	err = tx.QueryRow("select id, action, coalesce(description, '') from journal where undone = false order by id desc limit 1").Scan(&entry, &action, &description)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		log.Println(err)
+		return "", err
+	}
+
+	stmt := `update articles set
+		read = (select j.read from journal_articles j where j.entry_id = ? and j.article_id = articles.id),
+		deleted = (select j.deleted from journal_articles j where j.entry_id = ? and j.article_id = articles.id)`
+	args := []interface{}{entry, entry}
+	if journalActions[action].read {
+		stmt += ", read_changed = ?"
+		args = append(args, time.Now().UTC())
+	}
+	args = append(args, entry)
+	if _, err := tx.Exec(stmt+" where id in (select article_id from journal_articles where entry_id = ?)", args...); err != nil {
+		log.Println(err)
+		return "", err
+	}
+	if _, err := tx.Exec("update journal set undone = true, undone_order = (select coalesce(max(undone_order), 0) + 1 from journal) where id = ?", entry); err != nil {
+		log.Println(err)
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return "", err
+	}
+
+	if action == "delete" {
+		d.reindex(d.ids("select article_id from journal_articles where entry_id = ?", entry)...)
+	}
+	return description, nil
+}
+
+// Redo applies the last undone change in the journal again. The description
+// of the change is returned, or an empty string if there is nothing to redo.
+// Reads by selection may have been recorded after undone changes, so these
+// are redone in the reverse order they were undone in.
+func (d *DB) Redo() (string, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var (
+		entry               int
+		action, description string
+	)
+	err = tx.QueryRow("select id, action, coalesce(description, '') from journal where undone = true order by undone_order desc, id limit 1").Scan(&entry, &action, &description)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		log.Println(err)
+		return "", err
+	}
+
+	if err := d.apply(tx, journalActions[action], entry); err != nil {
+		log.Println(err)
+		return "", err
+	}
+	if _, err := tx.Exec("update journal set undone = false, undone_order = null where id = ?", entry); err != nil {
+		log.Println(err)
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return "", err
+	}
+
+	if action == "delete" {
+		d.unindex(d.ids("select article_id from journal_articles where entry_id = ?", entry)...)
+	}
+	return description, nil
+}
+
+// trimJournal removes the oldest changes from the journal, keeping the last
+// journalSize changes and as many reads by selection, so that browsing
+// doesn't push out e.g. a mark all read.
+func (d *DB) trimJournal() {
+	for _, stmt := range []string{
+		fmt.Sprintf("delete from journal where action = 'select' and id not in (select id from journal where action = 'select' order by id desc limit %d)", journalSize),
+		fmt.Sprintf("delete from journal where action != 'select' and id not in (select id from journal where action != 'select' order by id desc limit %d)", journalSize),
+		"delete from journal_articles where entry_id not in (select id from journal)",
+	} {
+		if _, err := d.db.Exec(stmt); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// Undo undoes the last change of articles and returns its description, or
+// an empty string if there is nothing to undo. The reader shows the
+// articles as they were before the change.
+func (c *Controller) Undo() (string, error) {
+	description, err := c.db.Undo()
+	if c.win != nil {
+		c.journalChanged("undo", "Undid", description, err)
+	}
+	return description, err
+}
+
+// Redo applies the last undone change of articles again and returns its
+// description, or an empty string if there is nothing to redo.
+func (c *Controller) Redo() (string, error) {
+	description, err := c.db.Redo()
+	if c.win != nil {
+		c.journalChanged("redo", "Redid", description, err)
+	}
+	return description, err
+}
+
+// journalChanged reloads the articles after an undo or redo and tells the
+// user what was changed.
+func (c *Controller) journalChanged(what, done, description string, err error) {
+	switch {
+	case err != nil:
+		c.win.StatusMessage(fmt.Sprintf("Failed to %s: %v", what, err))
+		return
+	case description == "":
+		c.win.StatusMessage(fmt.Sprintf("Nothing to %s", what))
+		return
+	}
+
+	prev := c.prevArticle
+	c.GetArticlesFromDB()
+	c.prevArticle = nil
+	for i := range c.articles {
+		if prev != nil && c.articles[i].id == prev.id {
+			c.prevArticle = &c.articles[i]
+		}
+	}
+	c.runSavedSearches()
+	c.ShowArticles(c.activeFeed)
+	c.win.StatusMessage(fmt.Sprintf("%s: %s", done, description))
+}
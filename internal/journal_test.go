@@ -0,0 +1,51 @@
+package internal
+
+import "testing"
+
+// readIDs returns the ids of the read articles
+func readIDs(t *testing.T, c *Controller) map[int]bool {
+	t.Helper()
+
+	read := map[int]bool{}
+	for _, id := range c.db.ids("select id from articles where read = true") {
+		read[id] = true
+	}
+	return read
+}
+
+func TestUndoSelected(t *testing.T) {
+	c := newTestController(t, `{}`)
+	articles := addTestArticles(t, c, "News", 3)
+
+	c.db.MarkAllRead("")
+	if _, err := c.db.Undo(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading by selection doesn't lose the mark all read that can be redone
+	c.db.MarkSelected(articles[0])
+	c.db.MarkSelected(articles[1])
+	if d, err := c.db.Undo(); err != nil || d != `read "News article 1"` {
+		t.Fatalf("undid %q, %v, want the last selected article", d, err)
+	}
+	if read := readIDs(t, c); len(read) != 1 || !read[articles[0].id] {
+		t.Errorf("read %v, want only the first article", read)
+	}
+
+	// Redone in the reverse order they were undone in
+	for _, want := range []string{`read "News article 1"`, "mark all read"} {
+		if d, err := c.db.Redo(); err != nil || d != want {
+			t.Errorf("redid %q, %v, want %q", d, err, want)
+		}
+	}
+	if read := readIDs(t, c); len(read) != 3 {
+		t.Errorf("read %v, want all articles", read)
+	}
+
+	// Any other change can't be redone after a new one
+	c.db.Undo()
+	c.db.MarkUnread(articles[2])
+	if d, _ := c.db.Redo(); d != "" {
+		t.Errorf("redid %q after a change", d)
+	}
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// NumberLinks adds a marker [n] after each link and image of HTML content.
+// The content is returned with the links, link n at index n-1. Relative
+// links are resolved against base, and a link that occurs more than once
+// keeps its first number.
+func NumberLinks(content string, base *url.URL) (string, []string) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(content), body)
+	if err != nil {
+		return content, nil
+	}
+
+	var links []string
+	numbers := make(map[string]int)
+	number := func(link string) int {
+		link = strings.TrimSpace(link)
+		if base != nil {
+			if u, err := base.Parse(link); err == nil {
+				link = u.String()
+			}
+		}
+		if n, ok := numbers[link]; ok {
+			return n
+		}
+		links = append(links, link)
+		numbers[link] = len(links)
+		return len(links)
+	}
+
+	var mark func(n *html.Node)
+	mark = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			switch {
+			case c.DataAtom == atom.A && linkable(attr(c, "href")):
+				mark(c)
+				c.AppendChild(&html.Node{Type: html.TextNode, Data: fmt.Sprintf(" [%d]", number(attr(c, "href")))})
+			case c.DataAtom == atom.Img && attr(c, "src") != "":
+				alt := strings.TrimSpace(attr(c, "alt"))
+				if alt == "" {
+					alt = "image"
+				}
+				n.InsertBefore(&html.Node{Type: html.TextNode, Data: fmt.Sprintf("%s [%d]", alt, number(attr(c, "src")))}, c)
+				n.RemoveChild(c)
+			default:
+				mark(c)
+			}
+			c = next
+		}
+	}
+
+	var out bytes.Buffer
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+	mark(body)
+	for n := body.FirstChild; n != nil; n = n.NextSibling {
+		if err := html.Render(&out, n); err != nil {
+			return content, nil
+		}
+	}
+	return out.String(), links
+}
+
+// linkable returns true if a link leads somewhere, i.e. isn't an anchor on
+// the same page or a script.
+func linkable(href string) bool {
+	href = strings.TrimSpace(href)
+	return href != "" && !strings.HasPrefix(href, "#") && !strings.HasPrefix(strings.ToLower(href), "javascript:")
+}
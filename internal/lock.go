@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Lock is a lock file held by the process that fetches the feeds of a
+// database. Other processes using the same database only read from it.
+//
+// The lock is an advisory lock of the operating system on the file, which
+// is released when the process exits, so there are no stale locks. The
+// file holds the pid of the process for messages, and is never removed.
+type Lock struct {
+	path string
+	f    *os.File
+}
+
+// LockedError is returned when another live process holds a lock
+type LockedError struct {
+	Path string
+	PID  int
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s is held by process %d", e.Path, e.PID)
+}
+
+// errLocked is returned by lockFile if another process holds the lock
+var errLocked = errors.New("locked")
+
+// LockFile returns the path of the lock file for a database
+func LockFile(dbFile string) string {
+	return dbFile + ".lock"
+}
+
+// AcquireLock locks the lock file and writes the pid of this process to
+// it. If another process holds the lock a *LockedError is returned.
+func AcquireLock(path string) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		if errors.Is(err, errLocked) {
+			return nil, &LockedError{Path: path, PID: lockPID(path)}
+		}
+		return nil, err
+	}
+
+	if err := f.Truncate(0); err == nil {
+		_, err = f.WriteAt([]byte(fmt.Sprintf("%d\n", os.Getpid())), 0)
+	}
+	if err != nil {
+		unlockFile(f)
+		f.Close()
+		return nil, err
+	}
+	return &Lock{path: path, f: f}, nil
+}
+
+// Release unlocks the lock file
+func (l *Lock) Release() error {
+	if l == nil {
+		return nil
+	}
+	l.f.Truncate(0)
+	unlockFile(l.f)
+	return l.f.Close()
+}
+
+// lockPID returns the pid written to a lock file, or 0 if it can't be read
+func lockPID(path string) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogfmtWriter turns the lines written by the standard logger into logfmt
+// records, e.g.
+//
+//	time=2023-04-01T12:00:00Z level=info msg="feeds updated" feeds=3 new=12
+//
+// Lines created with Logfmt keep their fields, all other lines are written
+// as the message of the record.
+type LogfmtWriter struct {
+	W  io.Writer
+	mu sync.Mutex
+}
+
+// Write writes one record per line of p
+func (l *LogfmtWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		buf.WriteString("time=")
+		buf.WriteString(time.Now().UTC().Format(time.RFC3339))
+		buf.WriteByte(' ')
+		if strings.HasPrefix(line, "level=") {
+			buf.WriteString(line)
+		} else {
+			buf.WriteString(Logfmt("info", line))
+		}
+		buf.WriteByte('\n')
+	}
+
+	if _, err := l.W.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Logfmt formats a log record with a level, a message and key/value pairs
+func Logfmt(level, msg string, kv ...interface{}) string {
+	var b strings.Builder
+	b.WriteString("level=")
+	b.WriteString(level)
+	b.WriteString(" msg=")
+	b.WriteString(logfmtValue(msg))
+
+	for i := 0; i < len(kv); i += 2 {
+		b.WriteByte(' ')
+		b.WriteString(fmt.Sprint(kv[i]))
+		b.WriteByte('=')
+		if i+1 < len(kv) {
+			b.WriteString(logfmtValue(fmt.Sprint(kv[i+1])))
+		}
+	}
+	return b.String()
+}
+
+// logfmtValue quotes a value if it contains spaces, quotes or equal signs
+func logfmtValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+		return strconv.Quote(v)
+	}
+	return v
+}
@@ -0,0 +1,300 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// migration changes the database schema to the next version
+type migration struct {
+	description string
+	up          func(tx *sql.Tx) error
+}
+
+// migrations are applied in order at startup and the schema version of a
+// database is the number of migrations applied to it. Never change or
+// remove a migration that has been released, add a new one instead.
+var migrations = []migration{
+	{"create articles table", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			create table if not exists articles(
+				id integer not null primary key,
+				feed text,
+				title text,
+				content text,
+				link text,
+				read bool,
+				display_name string,
+				deleted bool,
+				published DATETIME
+			);`)
+		return err
+	}},
+	{"create feeds table", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			create table if not exists feeds(
+				url text not null primary key,
+				title text,
+				etag text,
+				last_modified text
+			);`)
+		return err
+	}},
+	{"identify articles by guid", migrateGUID},
+	{"add starred to articles", func(tx *sql.Tx) error {
+		_, err := tx.Exec("alter table articles add column starred bool not null default false")
+		return err
+	}},
+	{"add website link to feeds", func(tx *sql.Tx) error {
+		_, err := tx.Exec("alter table feeds add column link text")
+		return err
+	}},
+	{"track article state for sync", func(tx *sql.Tx) error {
+		for _, stmt := range []string{
+			"alter table articles add column remote_id text",
+			"alter table articles add column remote_updated DATETIME",
+			"alter table articles add column read_changed DATETIME",
+			"alter table articles add column starred_changed DATETIME",
+			"create index if not exists articles_remote_id on articles(remote_id)",
+			"create table if not exists sync_state(name text not null primary key, value text)",
+		} {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"add full content to articles", func(tx *sql.Tx) error {
+		_, err := tx.Exec("alter table articles add column full_content text")
+		return err
+	}},
+	{"add author, color and tags to articles", func(tx *sql.Tx) error {
+		for _, stmt := range []string{
+			"alter table articles add column author text",
+			"alter table articles add column color text",
+			`create table if not exists article_tags(
+				article_id integer not null,
+				tag text not null,
+				primary key(article_id, tag)
+			)`,
+		} {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"index article tags by tag", func(tx *sql.Tx) error {
+		_, err := tx.Exec("create index if not exists article_tags_tag on article_tags(tag)")
+		return err
+	}},
+	{"create journal of changes", func(tx *sql.Tx) error {
+		for _, stmt := range []string{
+			`create table if not exists journal(
+				id integer not null primary key,
+				time DATETIME,
+				action text not null,
+				description text,
+				undone bool not null default false
+			)`,
+			`create table if not exists journal_articles(
+				entry_id integer not null,
+				article_id integer not null,
+				read bool,
+				deleted bool,
+				primary key(entry_id, article_id)
+			)`,
+		} {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"add feed health to feeds", func(tx *sql.Tx) error {
+		for _, stmt := range []string{
+			"alter table feeds add column failures integer not null default 0",
+			"alter table feeds add column last_error text",
+			"alter table feeds add column errors text",
+			"alter table feeds add column last_success DATETIME",
+			"alter table feeds add column next_fetch DATETIME",
+		} {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"order undone changes", func(tx *sql.Tx) error {
+		_, err := tx.Exec("alter table journal add column undone_order integer")
+		return err
+	}},
+}
+
+// Migrate brings the database up to the latest schema version. Each
+// migration runs in its own transaction. If the database already existed
+// a backup is taken before anything is changed. A database with a newer
+// schema than this version of gorss knows about is refused.
+func (d *DB) Migrate(dbFile string, existed bool) error {
+	version, err := d.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("database %s has schema version %d but this version of gorss only supports version %d, refusing to start", dbFile, version, len(migrations))
+	}
+
+	if version == len(migrations) {
+		return nil
+	}
+
+	backup := ""
+	if existed {
+		backup = fmt.Sprintf("%s.v%d.bak", dbFile, version)
+		if _, err := CopyFile(dbFile, backup); err != nil {
+			return fmt.Errorf("failed to backup database before migrating: %v", err)
+		}
+		log.Printf("Backed up database to %s before migrating", backup)
+	}
+
+	_, err = d.db.Exec(`
+		create table if not exists schema_version(
+			version integer not null primary key,
+			description text,
+			applied DATETIME
+		);`)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		m := migrations[i]
+		log.Printf("Migrating database to version %d: %s", i+1, m.description)
+
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if err := m.up(tx); err != nil {
+			tx.Rollback()
+			if backup != "" {
+				return fmt.Errorf("migration %d (%s) failed, the database before migrating is in %s: %v", i+1, m.description, backup, err)
+			}
+			return fmt.Errorf("migration %d (%s) failed: %v", i+1, m.description, err)
+		}
+
+		if _, err := tx.Exec("insert into schema_version(version, description, applied) values(?, ?, ?)", i+1, m.description, time.Now()); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the current schema version of the database, zero
+// if it has none yet. Nothing is written to the database.
+func (d *DB) SchemaVersion() (int, error) {
+	var tables int
+	if err := d.db.QueryRow("select count(*) from sqlite_master where type = 'table' and name = 'schema_version'").Scan(&tables); err != nil {
+		return 0, err
+	}
+	if tables == 0 {
+		return 0, nil
+	}
+
+	var version int
+	err := d.db.QueryRow("select coalesce(max(version), 0) from schema_version").Scan(&version)
+	return version, err
+}
+
+// migrateGUID adds the guid column to databases created before articles
+// had a stable identity. Existing articles get their link, or a hash of
+// their content, as guid.
+func migrateGUID(tx *sql.Tx) error {
+	rows, err := tx.Query("pragma table_info(articles)")
+	if err != nil {
+		return err
+	}
+	hasGUID := false
+	for rows.Next() {
+		var (
+			cid        int
+			name, kind string
+			notNull    bool
+			dflt       sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &kind, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		if name == "guid" {
+			hasGUID = true
+		}
+	}
+	rows.Close()
+
+	if !hasGUID {
+		if _, err := tx.Exec("alter table articles add column guid text"); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query("select id, feed, title, content, link from articles order by id")
+		if err != nil {
+			return err
+		}
+
+		type row struct {
+			id   int
+			guid string
+		}
+		var (
+			backfill []row
+			seen     = make(map[[2]string]bool)
+		)
+		for rows.Next() {
+			var (
+				id                         int
+				feed, title, content, link sql.NullString
+			)
+			if err := rows.Scan(&id, &feed, &title, &content, &link); err != nil {
+				rows.Close()
+				return err
+			}
+			guid := link.String
+			if guid == "" {
+				guid = ContentHash(title.String, content.String)
+			}
+			// Earlier versions could store the same article twice.
+			if seen[[2]string{feed.String, guid}] {
+				guid = fmt.Sprintf("%s#%d", guid, id)
+			}
+			seen[[2]string{feed.String, guid}] = true
+			backfill = append(backfill, row{id, guid})
+		}
+		rows.Close()
+
+		st, err := tx.Prepare("update articles set guid = ? where id = ?")
+		if err != nil {
+			return err
+		}
+		defer st.Close()
+
+		for _, r := range backfill {
+			if _, err := st.Exec(r.guid, r.id); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = tx.Exec("create unique index if not exists articles_feed_guid on articles(feed, guid)")
+	return err
+}
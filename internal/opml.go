@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gilliek/go-opml/opml"
+)
+
+// ExportOPML writes all feeds from the configuration and the OPML file to
+// w as an OPML 2.0 document. Categories are written as folders.
+func (c *Controller) ExportOPML(w io.Writer) error {
+	titles := c.db.FeedTitles()
+	links := c.db.FeedLinks()
+
+	root := &opmlFolder{folders: make(map[string]*opmlFolder)}
+	for _, f := range c.Feeds() {
+		text := f.Name
+		if text == "" {
+			text = titles[f.URL]
+		}
+		if text == "" {
+			text = f.URL
+		}
+
+		folder := root
+		if f.Category != "" {
+			for _, name := range strings.Split(f.Category, "/") {
+				folder = folder.folder(name)
+			}
+		}
+		folder.outlines = append(folder.outlines, opml.Outline{
+			Type:    "rss",
+			Text:    text,
+			Title:   text,
+			XMLURL:  f.URL,
+			HTMLURL: links[f.URL],
+		})
+	}
+
+	doc := opml.OPML{
+		Version: "2.0",
+		Head: opml.Head{
+			Title:       "gorss subscriptions",
+			DateCreated: time.Now().Format(time.RFC1123Z),
+		},
+		Body: opml.Body{Outlines: root.build()},
+	}
+
+	x, err := doc.XML()
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, x+"\n")
+	return err
+}
+
+// opmlFolder is used to build nested OPML outlines from categories
+type opmlFolder struct {
+	folders  map[string]*opmlFolder
+	outlines []opml.Outline
+}
+
+func (f *opmlFolder) folder(name string) *opmlFolder {
+	if _, ok := f.folders[name]; !ok {
+		f.folders[name] = &opmlFolder{folders: make(map[string]*opmlFolder)}
+	}
+	return f.folders[name]
+}
+
+func (f *opmlFolder) build() []opml.Outline {
+	var names []string
+	for name := range f.folders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	outlines := []opml.Outline{}
+	for _, name := range names {
+		outlines = append(outlines, opml.Outline{
+			Text:     name,
+			Title:    name,
+			Outlines: f.folders[name].build(),
+		})
+	}
+	return append(outlines, f.outlines...)
+}
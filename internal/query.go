@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArticleFilter selects articles, zero values match all articles
+type ArticleFilter struct {
+	// Feed is the URL, title or display name of a feed
+	Feed    string
+	Unread  bool
+	Starred bool
+	// Tag only matches articles with this tag, ignoring case
+	Tag string
+	// Since and Before limit the time the articles were published
+	Since  time.Time
+	Before time.Time
+}
+
+// Articles returns the articles matching the filter, newest first
+func (c *Controller) Articles(f ArticleFilter) []Article {
+	feedTitle := ""
+	if f.Feed != "" {
+		feedTitle = c.rss.Title(f.Feed)
+	}
+
+	articles := []Article{}
+	for _, a := range c.db.All() {
+		if f.Feed != "" && !strings.EqualFold(a.feed, f.Feed) && !strings.EqualFold(a.feedDisplay, f.Feed) && a.feed != feedTitle {
+			continue
+		}
+		if f.Unread && a.read {
+			continue
+		}
+		if f.Starred && !a.starred {
+			continue
+		}
+		if f.Tag != "" && !a.HasTag(f.Tag) {
+			continue
+		}
+		if !f.Since.IsZero() && a.published.Before(f.Since) {
+			continue
+		}
+		if !f.Before.IsZero() && !a.published.Before(f.Before) {
+			continue
+		}
+		a.c = c
+		articles = append(articles, a)
+	}
+
+	sort.SliceStable(articles, func(i, j int) bool {
+		return articles[i].published.After(articles[j].published)
+	})
+	return articles
+}
+
+// Article returns the article with the given id
+func (c *Controller) Article(id int) (*Article, error) {
+	if articles := c.db.Articles([]int{id}); len(articles) > 0 {
+		a := &articles[0]
+		a.c = c
+		return a, nil
+	}
+	return nil, fmt.Errorf("no article with id %d", id)
+}
+
+// MarkArticlesRead marks the articles as read, as one change that can be
+// undone, and returns how many of them were unread.
+func (c *Controller) MarkArticlesRead(articles []Article) int {
+	var unread []*Article
+	for i := range articles {
+		if !articles[i].read {
+			unread = append(unread, &articles[i])
+		}
+	}
+	if err := c.db.MarkRead(unread...); err != nil {
+		return 0
+	}
+	for _, a := range unread {
+		a.read = true
+	}
+	return len(unread)
+}
+
+// ParseAge parses a duration such as 90m, 24h or 7d
+func ParseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid age: %s", s)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age: %s", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,291 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxPageSize is the largest web page read when extracting an article
+const maxPageSize = 5 << 20
+
+// Class names and ids of elements that are unlikely to be, or likely to be,
+// part of the article.
+var (
+	unlikelyCandidates = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|footer|header|legends|menu|modal|nav|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|ad-break|agegate|pagination|pager|popup|promo|subscribe|newsletter`)
+	maybeCandidate     = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveNames      = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negativeNames      = regexp.MustCompile(`(?i)hidden|banner|combx|comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// removedElements are never part of the article
+var removedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Iframe: true,
+	atom.Form: true, atom.Button: true, atom.Input: true, atom.Select: true,
+	atom.Textarea: true, atom.Nav: true, atom.Aside: true, atom.Footer: true,
+	atom.Header: true, atom.Svg: true, atom.Object: true, atom.Embed: true,
+	atom.Link: true, atom.Meta: true,
+}
+
+// Readable extracts the main content of a web page, similar to the reader
+// view of browsers. The content is returned as HTML with links made
+// absolute to base. An error is returned if no content is found.
+func Readable(r io.Reader, base *url.URL) (string, error) {
+	doc, err := html.Parse(io.LimitReader(r, maxPageSize))
+	if err != nil {
+		return "", err
+	}
+
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return "", fmt.Errorf("page has no body")
+	}
+	clean(body)
+
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+	walk(body, func(n *html.Node) {
+		if n.DataAtom != atom.P && n.DataAtom != atom.Pre && n.DataAtom != atom.Td {
+			return
+		}
+		text := strings.TrimSpace(textContent(n))
+		if len(text) < 25 {
+			return
+		}
+
+		// Paragraphs with more text and commas are more likely prose
+		length := float64(len(text) / 100)
+		if length > 3 {
+			length = 3
+		}
+		score := 1 + float64(strings.Count(text, ",")) + length
+		for i, p := 0, n.Parent; i < 3 && p != nil && p.Type == html.ElementNode; i, p = i+1, p.Parent {
+			if _, ok := scores[p]; !ok {
+				scores[p] = initialScore(p)
+				candidates = append(candidates, p)
+			}
+			switch i {
+			case 0:
+				scores[p] += score
+			case 1:
+				scores[p] += score / 2
+			default:
+				scores[p] += score / 6
+			}
+		}
+	})
+
+	var top *html.Node
+	for _, n := range candidates {
+		scores[n] *= 1 - linkDensity(n)
+		if top == nil || scores[n] > scores[top] {
+			top = n
+		}
+	}
+	if top == nil {
+		return "", fmt.Errorf("no article content found")
+	}
+
+	// Siblings of the top candidate, such as other sections of the
+	// article, are included if they score well enough.
+	var out bytes.Buffer
+	threshold := scores[top] * 0.2
+	if threshold < 10 {
+		threshold = 10
+	}
+	var nodes []*html.Node
+	if top.DataAtom == atom.Body {
+		for c := top.FirstChild; c != nil; c = c.NextSibling {
+			nodes = append(nodes, c)
+		}
+	} else {
+		for s := top.Parent.FirstChild; s != nil; s = s.NextSibling {
+			if s == top || (s.Type == html.ElementNode && relatedSibling(s, scores, threshold)) {
+				nodes = append(nodes, s)
+			}
+		}
+	}
+	for _, n := range nodes {
+		absolute(n, base)
+		if err := html.Render(&out, n); err != nil {
+			return "", err
+		}
+	}
+
+	content := strings.TrimSpace(out.String())
+	if content == "" {
+		return "", fmt.Errorf("no article content found")
+	}
+	return content, nil
+}
+
+// relatedSibling returns true if a sibling of the top candidate is part of
+// the article as well.
+func relatedSibling(n *html.Node, scores map[*html.Node]float64, threshold float64) bool {
+	if score, ok := scores[n]; ok && score >= threshold {
+		return true
+	}
+	if n.DataAtom != atom.P {
+		return false
+	}
+	text := textContent(n)
+	density := linkDensity(n)
+	return (len(text) > 80 && density < 0.25) ||
+		(len(text) > 0 && len(text) <= 80 && density == 0 && strings.Contains(text, ". "))
+}
+
+// clean removes elements that are not part of the article, e.g. scripts and
+// elements with class names such as sidebar or comments.
+func clean(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || (c.Type == html.ElementNode && unlikely(c)) {
+			n.RemoveChild(c)
+		} else {
+			clean(c)
+		}
+		c = next
+	}
+}
+
+// unlikely returns true if an element is unlikely to be part of the article
+func unlikely(n *html.Node) bool {
+	if removedElements[n.DataAtom] {
+		return true
+	}
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Article || n.DataAtom == atom.Main || n.DataAtom == atom.A {
+		return false
+	}
+	if strings.EqualFold(attr(n, "aria-hidden"), "true") || hasAttr(n, "hidden") || strings.Contains(attr(n, "style"), "display:none") {
+		return true
+	}
+	names := attr(n, "class") + " " + attr(n, "id")
+	return unlikelyCandidates.MatchString(names) && !maybeCandidate.MatchString(names)
+}
+
+// initialScore scores an element by its tag and class names
+func initialScore(n *html.Node) float64 {
+	score := 0.0
+	switch n.DataAtom {
+	case atom.Article, atom.Main:
+		score += 10
+	case atom.Div:
+		score += 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score += 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li:
+		score -= 3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score -= 5
+	}
+
+	for _, name := range []string{attr(n, "class"), attr(n, "id")} {
+		if name == "" {
+			continue
+		}
+		if negativeNames.MatchString(name) {
+			score -= 25
+		}
+		if positiveNames.MatchString(name) {
+			score += 25
+		}
+	}
+	return score
+}
+
+// linkDensity returns the share of the text of an element that is links
+func linkDensity(n *html.Node) float64 {
+	total := len(textContent(n))
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	walk(n, func(c *html.Node) {
+		if c.DataAtom == atom.A {
+			links += len(textContent(c))
+		}
+	})
+	return float64(links) / float64(total)
+}
+
+// absolute makes the links and images of an element absolute to base
+func absolute(n *html.Node, base *url.URL) {
+	if base == nil {
+		return
+	}
+	walk(n, func(c *html.Node) {
+		for i, a := range c.Attr {
+			if a.Key != "href" && a.Key != "src" {
+				continue
+			}
+			if u, err := base.Parse(strings.TrimSpace(a.Val)); err == nil {
+				c.Attr[i].Val = u.String()
+			}
+		}
+	})
+}
+
+// textContent returns the text of a node and its children
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var text func(*html.Node)
+	text = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			text(c)
+		}
+	}
+	text(n)
+	return b.String()
+}
+
+// findElement returns the first element of a type
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if f := findElement(c, a); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// walk calls fn for all elements below a node, including the node itself
+func walk(n *html.Node, fn func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		fn(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+// hasAttr returns true if an element has an attribute
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// attr returns the value of an attribute of an element
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
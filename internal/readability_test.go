@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadable(t *testing.T) {
+	base, _ := url.Parse("https://example.com/posts/feed-reader")
+
+	tests := []struct {
+		file    string
+		want    []string
+		notWant []string
+	}{
+		{
+			file: "testdata/blog.html",
+			want: []string{
+				"Feed readers are small programs",
+				"skips feeds that have not changed",
+				`src="https://example.com/images/diagram.png"`,
+				`href="https://example.com/posts/caching"`,
+			},
+			notWant: []string{"tracking", "Archive", "Great post", "newsletter", "Copyright"},
+		},
+		{
+			file: "testdata/news.html",
+			want: []string{
+				"extend the bike lanes",
+				"Construction starts in the spring",
+				"Residents along the route",
+				"outside of the holiday season",
+			},
+			notWant: []string{"Buy now", "Sports", "Council approves budget"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			f, err := os.Open(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			content, err := Readable(f, base)
+			if err != nil {
+				t.Fatalf("Readable: %v", err)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(content, s) {
+					t.Errorf("content doesn't contain %q:\n%s", s, content)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(content, s) {
+					t.Errorf("content contains %q:\n%s", s, content)
+				}
+			}
+		})
+	}
+}
+
+func TestReadableNoContent(t *testing.T) {
+	f, err := os.Open("testdata/empty.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if content, err := Readable(f, nil); err == nil {
+		t.Errorf("expected an error, got %q", content)
+	}
+}
@@ -1,10 +1,14 @@
 package internal
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gilliek/go-opml/opml"
 	"github.com/mmcdole/gofeed"
@@ -16,38 +20,57 @@ type RSS struct {
 		displayName string
 		feed        *gofeed.Feed
 	}
-	c *Controller
+	titles map[string]string
+	tLock  sync.Mutex
+	c      *Controller
 }
 
 // Init reads an feed related configuration
 func (r *RSS) Init(c *Controller) {
 	r.c = c
+	r.titles = r.c.db.FeedTitles()
+	r.c.setFeeds(append(r.c.Feeds(), r.loadOPML()...))
+}
 
-	// Check if we have any OMPL file to load
-	if r.c.conf.OPMLFile != "" {
-		doc, err := opml.NewOPMLFromFile(r.c.conf.OPMLFile)
-		if err != nil {
-			log.Printf("Failed to load OPML file, %v", err)
-			return
-		}
+// loadOPML returns the feeds of the OPML file, if any
+func (r *RSS) loadOPML() []Feed {
+	if r.c.conf.OPMLFile == "" {
+		return nil
+	}
 
-		// Add URLs to the list of feeds
-		for _, b := range doc.Body.Outlines {
-			if b.Outlines != nil {
-				for _, o := range b.Outlines {
-					url := r.GetURLFromOPML(o)
-					if url != "" {
-						r.c.conf.Feeds = append(r.c.conf.Feeds, Feed{URL: url})
-					}
-				}
-			} else {
-				url := r.GetURLFromOPML(b)
-				if url != "" {
-					r.c.conf.Feeds = append(r.c.conf.Feeds, Feed{URL: url})
-				}
+	doc, err := opml.NewOPMLFromFile(r.c.conf.OPMLFile)
+	if err != nil {
+		log.Printf("Failed to load OPML file, %v", err)
+		return nil
+	}
+
+	// Add URLs to the list of feeds, folders are used as categories
+	return r.addOPMLOutlines(nil, doc.Body.Outlines, "")
+}
+
+// addOPMLOutlines adds the feeds of OPML outlines to feeds. Nested folders
+// are joined with a slash to form the category.
+func (r *RSS) addOPMLOutlines(feeds []Feed, outlines []opml.Outline, category string) []Feed {
+	for _, o := range outlines {
+		if o.Outlines != nil {
+			name := o.Title
+			if name == "" {
+				name = o.Text
+			}
+			sub := name
+			if category != "" {
+				sub = category + "/" + name
 			}
+			feeds = r.addOPMLOutlines(feeds, o.Outlines, sub)
+			continue
+		}
+
+		url := r.GetURLFromOPML(o)
+		if url != "" {
+			feeds = append(feeds, Feed{URL: url, Category: category})
 		}
 	}
+	return feeds
 }
 
 // GetURLFromOPML retrieves any URL from the OPML object
@@ -63,9 +86,10 @@ func (r *RSS) GetURLFromOPML(b opml.Outline) string {
 	return str
 }
 
-// Update fetches all articles for all feeds
-func (r *RSS) Update() {
+// Update fetches all articles for the given feeds
+func (r *RSS) Update(feeds []Feed) {
 	fp := gofeed.NewParser()
+	fp.RSSTranslator = &rssTranslator{}
 	r.feeds = []struct {
 		displayName string
 		feed        *gofeed.Feed
@@ -75,13 +99,18 @@ func (r *RSS) Update() {
 
 	var wg sync.WaitGroup
 
-	for _, f := range r.c.conf.Feeds {
+	for _, f := range feeds {
 		wg.Add(1)
 		go func(f Feed) {
 			feed, err := r.FetchURL(fp, f.URL)
+			r.c.sched.Done(f, feed, err, time.Now())
 			if err != nil {
 				log.Printf("error fetching url: %s, err: %v", f.URL, err)
 			} else {
+				r.tLock.Lock()
+				r.titles[f.URL] = feed.Title
+				r.tLock.Unlock()
+
 				mu.Lock()
 				r.feeds = append(r.feeds, struct {
 					displayName string
@@ -98,9 +127,112 @@ func (r *RSS) Update() {
 	wg.Wait()
 }
 
+// Title returns the title of a feed URL, or an empty string if the feed
+// has never been fetched.
+func (r *RSS) Title(url string) string {
+	r.tLock.Lock()
+	defer r.tLock.Unlock()
+	return r.titles[url]
+}
+
+// Category returns the category of the feed with the given title
+func (r *RSS) Category(title string) string {
+	r.tLock.Lock()
+	defer r.tLock.Unlock()
+
+	for _, f := range r.c.Feeds() {
+		if r.titles[f.URL] == title {
+			return f.Category
+		}
+	}
+	return ""
+}
+
+// FeedIndex returns the position in the configuration of the feed with the
+// given title, or 0 if the feed hasn't been fetched yet.
+func (r *RSS) FeedIndex(title string) int {
+	r.tLock.Lock()
+	defer r.tLock.Unlock()
+
+	for i, f := range r.c.Feeds() {
+		if r.titles[f.URL] == title {
+			return i
+		}
+	}
+	return 0
+}
+
 // FetchURL fetches the feed URL and also fakes the user-agent to be able
 // to retrieve data from sites like reddit.
+// The ETag and Last-Modified headers of the response are stored in the
+// database and sent back on the next request. If the server answers with
+// 304 Not Modified the feed is not parsed and a feed without items is returned.
 func (r *RSS) FetchURL(fp *gofeed.Parser, url string) (feed *gofeed.Feed, err error) {
+	title, etag, lastModified := r.c.db.FeedCache(url)
+
+	resp, err := r.get(url, etag, lastModified)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		ce := resp.Body.Close()
+		if ce != nil {
+			err = ce
+		}
+	}()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return &gofeed.Feed{Title: title}, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	feed, err = fp.Parse(bytes.NewReader(body))
+	if err != nil {
+		// Tell which feeds the page has if the URL is a web page
+		if strings.Contains(resp.Header.Get("Content-Type"), "html") {
+			return nil, &DiscoveryError{URL: url, Candidates: FeedLinks(bytes.NewReader(body), resp.Request.URL)}
+		}
+		return nil, err
+	}
+
+	r.c.db.SaveFeedCache(url, feed.Title, feed.Link, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"))
+
+	return feed, nil
+}
+
+// ParseURL fetches and parses a feed URL without using or updating the
+// HTTP cache, e.g. to validate a new feed.
+func (r *RSS) ParseURL(url string) (feed *gofeed.Feed, err error) {
+	resp, err := r.get(url, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		ce := resp.Body.Close()
+		if ce != nil {
+			err = ce
+		}
+	}()
+
+	return parseFeed(resp.Body)
+}
+
+// parseFeed parses a feed, keeping the <ttl> of RSS feeds
+func parseFeed(body io.Reader) (*gofeed.Feed, error) {
+	fp := gofeed.NewParser()
+	fp.RSSTranslator = &rssTranslator{}
+	return fp.Parse(body)
+}
+
+// get requests a URL with the given cache validators. A response is only
+// returned for 2xx and 304 status codes.
+func (r *RSS) get(url, etag, lastModified string) (*http.Response, error) {
 	client := &http.Client{}
 
 	req, err := http.NewRequest("GET", url, nil)
@@ -108,25 +240,26 @@ func (r *RSS) FetchURL(fp *gofeed.Parser, url string) (feed *gofeed.Feed, err er
 		return nil, err
 	}
 
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/74.0.3729.169 Safari/537.36")
 	resp, err := client.Do(req)
-
 	if err != nil {
 		return nil, err
 	}
 
-	if resp != nil {
-		defer func() {
-			ce := resp.Body.Close()
-			if ce != nil {
-				err = ce
-			}
-		}()
+	if resp.StatusCode == http.StatusNotModified {
+		return resp, nil
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
 		return nil, fmt.Errorf("failed to get url %v, %v", resp.StatusCode, resp.Status)
 	}
-
-	return fp.Parse(resp.Body)
+	return resp, nil
 }
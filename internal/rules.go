@@ -0,0 +1,219 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Rule changes new articles before they are saved. A rule matches an
+// article if all of its conditions match, and then all of its actions are
+// applied. Rules are applied in order.
+type Rule struct {
+	Name string `json:"name"`
+
+	// Conditions
+	// Feeds are titles, names, URLs or categories of feeds
+	Feeds []string `json:"feeds"`
+	// Title, Content and Author are regular expressions
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	Author  string `json:"author"`
+	// OlderThan and NewerThan are ages such as 12h or 7d
+	OlderThan string `json:"olderThan"`
+	NewerThan string `json:"newerThan"`
+
+	// Actions
+	MarkRead bool     `json:"markRead"`
+	Delete   bool     `json:"delete"`
+	Star     bool     `json:"star"`
+	Tags     []string `json:"tags"`
+	// Highlight is a color, or the name of a color of the theme such as
+	// warning, that the title is shown in.
+	Highlight string `json:"highlight"`
+	// Skip doesn't save the article at all
+	Skip bool `json:"skip"`
+
+	title     *regexp.Regexp
+	content   *regexp.Regexp
+	author    *regexp.Regexp
+	olderThan time.Duration
+	newerThan time.Duration
+}
+
+// compile checks the rule and compiles its regular expressions
+func (r *Rule) compile() error {
+	var err error
+	for _, re := range []struct {
+		expr string
+		dst  **regexp.Regexp
+	}{
+		{r.Title, &r.title},
+		{r.Content, &r.content},
+		{r.Author, &r.author},
+	} {
+		if re.expr == "" {
+			continue
+		}
+		if *re.dst, err = regexp.Compile(re.expr); err != nil {
+			return fmt.Errorf("invalid regular expression %q: %v", re.expr, err)
+		}
+	}
+	if r.OlderThan != "" {
+		if r.olderThan, err = ParseAge(r.OlderThan); err != nil {
+			return err
+		}
+	}
+	if r.NewerThan != "" {
+		if r.newerThan, err = ParseAge(r.NewerThan); err != nil {
+			return err
+		}
+	}
+	if r.Actions() == "" {
+		return fmt.Errorf("rule has no actions")
+	}
+	return nil
+}
+
+// String returns the name of the rule, or its conditions if it has no name
+func (r *Rule) String() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	var conds []string
+	if len(r.Feeds) > 0 {
+		conds = append(conds, "feeds="+strings.Join(r.Feeds, ","))
+	}
+	for _, c := range []struct{ name, value string }{
+		{"title", r.Title},
+		{"content", r.Content},
+		{"author", r.Author},
+		{"olderThan", r.OlderThan},
+		{"newerThan", r.NewerThan},
+	} {
+		if c.value != "" {
+			conds = append(conds, c.name+"="+c.value)
+		}
+	}
+	return strings.Join(conds, " ")
+}
+
+// Actions returns the actions of the rule as text
+func (r *Rule) Actions() string {
+	var actions []string
+	if r.Skip {
+		actions = append(actions, "skip")
+	}
+	if r.Delete {
+		actions = append(actions, "delete")
+	}
+	if r.MarkRead {
+		actions = append(actions, "mark read")
+	}
+	if r.Star {
+		actions = append(actions, "star")
+	}
+	for _, t := range r.Tags {
+		actions = append(actions, "tag "+t)
+	}
+	if r.Highlight != "" {
+		actions = append(actions, "highlight "+r.Highlight)
+	}
+	return strings.Join(actions, ", ")
+}
+
+// Matches returns true if all conditions of the rule match an article
+func (r *Rule) Matches(c *Controller, a *Article) bool {
+	if len(r.Feeds) > 0 && !c.matchesFeed(r.Feeds, a) {
+		return false
+	}
+	if r.title != nil && !r.title.MatchString(a.title) {
+		return false
+	}
+	if r.content != nil && !r.content.MatchString(a.content) {
+		return false
+	}
+	if r.author != nil && !r.author.MatchString(a.author) {
+		return false
+	}
+	age := time.Since(a.published)
+	if r.olderThan > 0 && age < r.olderThan {
+		return false
+	}
+	if r.newerThan > 0 && age > r.newerThan {
+		return false
+	}
+	return true
+}
+
+// apply applies the actions of the rule to an article
+func (r *Rule) apply(a *Article) {
+	if r.MarkRead {
+		a.read = true
+	}
+	if r.Delete {
+		a.deleted = true
+	}
+	if r.Star {
+		a.starred = true
+	}
+	for _, t := range r.Tags {
+		if !a.HasTag(t) {
+			a.tags = append(a.tags, t)
+		}
+	}
+	if r.Highlight != "" {
+		a.color = r.Highlight
+	}
+}
+
+// MatchRules returns the rules that match an article, without applying them
+func (c *Controller) MatchRules(a *Article) []*Rule {
+	var rules []*Rule
+	for i := range c.conf.Rules {
+		if c.conf.Rules[i].Matches(c, a) {
+			rules = append(rules, &c.conf.Rules[i])
+		}
+	}
+	return rules
+}
+
+// applyRules applies the matching rules to a new article. False is returned
+// if the article should not be saved.
+func (c *Controller) applyRules(a *Article) bool {
+	for _, r := range c.MatchRules(a) {
+		if r.Skip {
+			return false
+		}
+		r.apply(a)
+	}
+	return true
+}
+
+// matchesFeed returns true if an article is from one of the feeds, given by
+// title, name, URL or category.
+func (c *Controller) matchesFeed(feeds []string, a *Article) bool {
+	category := c.rss.Category(a.feed)
+	for _, f := range feeds {
+		if strings.EqualFold(f, a.feed) || strings.EqualFold(f, a.feedDisplay) ||
+			c.rss.Title(f) == a.feed || (category != "" && strings.EqualFold(f, category)) {
+			return true
+		}
+	}
+	return false
+}
+
+// color returns a color of the theme by its name, e.g. warning, or the
+// name itself if the theme has no such color.
+func (t *Theme) color(name string) string {
+	v := reflect.ValueOf(t).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		tag := v.Type().Field(i).Tag.Get("json")
+		if strings.EqualFold(tag, name) && v.Field(i).Kind() == reflect.String {
+			return v.Field(i).String()
+		}
+	}
+	return name
+}
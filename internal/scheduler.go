@@ -0,0 +1,238 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/rss"
+)
+
+const (
+	// maxHintInterval caps the refresh interval a feed may ask for itself
+	// through <ttl> or sy:updatePeriod.
+	maxHintInterval = 24 * time.Hour
+	// minBackoff is the delay before the first retry of a failing feed.
+	// It is doubled for each consecutive failure up to maxBackoff.
+	minBackoff = 30 * time.Second
+	maxBackoff = 6 * time.Hour
+	// maxHealthErrors is the number of recent errors kept per feed
+	maxHealthErrors = 10
+)
+
+// FeedHealth holds the fetch status of a feed
+type FeedHealth struct {
+	URL         string
+	Failures    int
+	LastError   string
+	LastSuccess time.Time
+	Errors      []string
+}
+
+// Scheduler keeps track of when each feed is due for an update
+type Scheduler struct {
+	c      *Controller
+	mu     sync.Mutex
+	next   map[string]time.Time
+	hints  map[string]time.Duration
+	health map[string]*FeedHealth
+}
+
+// Init sets up the scheduler. All feeds are due right away, except failing
+// feeds that are still backing off from before a restart.
+func (s *Scheduler) Init(c *Controller) {
+	s.c = c
+	s.next = make(map[string]time.Time)
+	s.hints = make(map[string]time.Duration)
+	s.health = make(map[string]*FeedHealth)
+	if c.db != nil {
+		s.health, s.next = c.db.FeedHealth()
+	}
+}
+
+// Due returns the feeds that should be fetched at the given time. The
+// returned feeds are not due again until Done has been called or their
+// interval has passed.
+func (s *Scheduler) Due(now time.Time) []Feed {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := []Feed{}
+	for _, f := range s.c.Feeds() {
+		// Remote feeds are synced, see Controller.Sync
+		if f.Remote {
+			continue
+		}
+		if next, ok := s.next[f.URL]; !ok || !now.Before(next) {
+			due = append(due, f)
+			s.next[f.URL] = now.Add(s.interval(f))
+		}
+	}
+	return due
+}
+
+// Done schedules the next update of a feed that has just been fetched and
+// records its health. Feeds that keep failing are retried with an
+// exponential backoff.
+func (s *Scheduler) Done(f Feed, feed *gofeed.Feed, err error, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.health[f.URL]
+	if !ok {
+		h = &FeedHealth{URL: f.URL}
+		s.health[f.URL] = h
+	}
+
+	if err != nil {
+		h.Failures++
+		h.LastError = err.Error()
+		h.Errors = append(h.Errors, fmt.Sprintf("%s %s", now.Format("2006-01-02 15:04:05"), err))
+		if len(h.Errors) > maxHealthErrors {
+			h.Errors = h.Errors[len(h.Errors)-maxHealthErrors:]
+		}
+
+		backoff := maxBackoff
+		if h.Failures < 16 {
+			backoff = minBackoff << uint(h.Failures-1)
+		}
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		s.next[f.URL] = now.Add(backoff)
+		s.save(h)
+		return
+	}
+
+	h.Failures = 0
+	h.LastSuccess = now
+
+	if feed != nil {
+		if hint := FeedHint(feed); hint > 0 {
+			s.hints[f.URL] = hint
+		}
+	}
+
+	interval := s.interval(f)
+	// Add some jitter so that feeds with the same interval drift apart
+	// instead of all being fetched at the same moment.
+	jitter := time.Duration(rand.Int63n(int64(interval)/10 + 1))
+	s.next[f.URL] = now.Add(interval + jitter)
+	s.save(h)
+}
+
+// save stores the health of a feed in the database, so that failing feeds
+// keep backing off after a restart.
+func (s *Scheduler) save(h *FeedHealth) {
+	if s.c.db != nil {
+		s.c.db.SaveFeedHealth(h, s.next[h.URL])
+	}
+}
+
+// Health returns a copy of the health of all feeds that have been fetched
+func (s *Scheduler) Health() map[string]FeedHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	health := make(map[string]FeedHealth)
+	for url, h := range s.health {
+		c := *h
+		c.Errors = append([]string{}, h.Errors...)
+		health[url] = c
+	}
+	return health
+}
+
+// Interval returns the time between updates of a feed
+func (s *Scheduler) Interval(f Feed) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.interval(f)
+}
+
+func (s *Scheduler) interval(f Feed) time.Duration {
+	// An interval set in the configuration always wins
+	if f.Interval > 0 {
+		return time.Duration(f.Interval) * time.Second
+	}
+
+	interval := time.Duration(s.c.conf.SecondsBetweenUpdates) * time.Second
+	if hint, ok := s.hints[f.URL]; ok && hint > interval {
+		interval = hint
+	}
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	return interval
+}
+
+// FeedHint returns the refresh interval the feed itself asks for, using
+// either the RSS <ttl> or the sy:updatePeriod/sy:updateFrequency elements.
+// Zero is returned if the feed has no such hints.
+func FeedHint(feed *gofeed.Feed) time.Duration {
+	var hint time.Duration
+
+	if ttl, ok := feed.Custom["ttl"]; ok {
+		if m, err := strconv.Atoi(strings.TrimSpace(ttl)); err == nil && m > 0 {
+			hint = time.Duration(m) * time.Minute
+		}
+	}
+
+	if hint == 0 {
+		if sy, ok := feed.Extensions["sy"]; ok {
+			var period time.Duration
+			if p, ok := sy["updatePeriod"]; ok && len(p) > 0 {
+				switch strings.ToLower(strings.TrimSpace(p[0].Value)) {
+				case "hourly":
+					period = time.Hour
+				case "daily":
+					period = 24 * time.Hour
+				case "weekly":
+					period = 7 * 24 * time.Hour
+				case "monthly":
+					period = 30 * 24 * time.Hour
+				case "yearly":
+					period = 365 * 24 * time.Hour
+				}
+			}
+			frequency := 1
+			if f, ok := sy["updateFrequency"]; ok && len(f) > 0 {
+				if n, err := strconv.Atoi(strings.TrimSpace(f[0].Value)); err == nil && n > 0 {
+					frequency = n
+				}
+			}
+			hint = period / time.Duration(frequency)
+		}
+	}
+
+	if hint > maxHintInterval {
+		hint = maxHintInterval
+	}
+	return hint
+}
+
+// rssTranslator keeps the <ttl> of RSS feeds in feed.Custom since the
+// default translator drops it.
+type rssTranslator struct {
+	gofeed.DefaultRSSTranslator
+}
+
+// Translate converts an RSS feed to the universal feed type
+func (t *rssTranslator) Translate(feed interface{}) (*gofeed.Feed, error) {
+	f, err := t.DefaultRSSTranslator.Translate(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	if rf, ok := feed.(*rss.Feed); ok && rf.TTL != "" {
+		if f.Custom == nil {
+			f.Custom = make(map[string]string)
+		}
+		f.Custom["ttl"] = rf.TTL
+	}
+	return f, nil
+}
@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"jaytaylor.com/html2text"
+)
+
+const (
+	// Markers around matches in highlighted titles returned by Search
+	matchStart = "\x01"
+	matchEnd   = "\x02"
+)
+
+// SearchHit is an article matching a search query. Title holds the title
+// with matches surrounded by matchStart and matchEnd.
+type SearchHit struct {
+	ID    int
+	Title string
+}
+
+// FullTextSearch returns true if SQLite was built with FTS5, i.e. gorss was
+// built with the sqlite_fts5 tag.
+func FullTextSearch() bool {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return false
+	}
+	defer db.Close()
+
+	_, err = db.Exec("create virtual table fts using fts5(text)")
+	return err == nil
+}
+
+// initFTS sets up the full-text index of articles. FTS5 is only available
+// when gorss is built with the sqlite_fts5 tag, without it search falls
+// back to matching words in titles.
+func (d *DB) initFTS() {
+	_, err := d.db.Exec("create virtual table if not exists articles_fts using fts5(title, content, feed)")
+	if err != nil {
+		log.Printf("Full-text search not available (build with -tags sqlite_fts5): %v", err)
+		return
+	}
+	d.fts = true
+
+	// Index articles stored before the index existed
+	d.reindex()
+}
+
+// reindex indexes the articles with the given ids again, e.g. deleted
+// articles that have been restored. Without ids the articles missing from
+// the full-text index are added.
+func (d *DB) reindex(ids ...int) {
+	if !d.fts {
+		return
+	}
+	if len(ids) == 0 {
+		d.indexWhere("id not in (select rowid from articles_fts)")
+		return
+	}
+	d.unindex(ids...)
+	for _, b := range batches(ids) {
+		d.indexWhere("id in "+b.in, b.args...)
+	}
+}
+
+// indexWhere adds the articles matching a condition to the full-text index
+func (d *DB) indexWhere(where string, args ...interface{}) {
+	rows, err := d.db.Query("select id, title, content, feed, display_name from articles where deleted = false and "+where, args...)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	var articles []Article
+	for rows.Next() {
+		var (
+			a                             Article
+			title, content, feed, display sql.NullString
+		)
+		if err := rows.Scan(&a.id, &title, &content, &feed, &display); err != nil {
+			log.Println(err)
+			continue
+		}
+		a.title, a.content, a.feed, a.feedDisplay = title.String, content.String, feed.String, display.String
+		articles = append(articles, a)
+	}
+	rows.Close()
+
+	if len(articles) == 0 {
+		return
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer tx.Rollback()
+
+	for _, a := range articles {
+		if err := d.index(tx, a); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+	}
+}
+
+// index adds an article to the full-text index
+func (d *DB) index(tx *sql.Tx, a Article) error {
+	if !d.fts {
+		return nil
+	}
+	_, err := tx.Exec(
+		"insert into articles_fts(rowid, title, content, feed) values(?, ?, ?, ?)",
+		a.id, a.title, HTMLToText(a.content), strings.TrimSpace(a.feed+" "+a.feedDisplay),
+	)
+	return err
+}
+
+// unindex removes articles that are deleted or no longer exist from the
+// full-text index
+func (d *DB) unindex(ids ...int) {
+	if !d.fts {
+		return
+	}
+	for _, b := range batches(ids) {
+		if _, err := d.db.Exec("delete from articles_fts where rowid in "+b.in, b.args...); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// Search returns the articles matching a query, best match first.
+//
+// The query supports "exact phrases", prefix* matching and the field
+// filters title: and feed:, e.g. `feed:golang "error handling" gener*`.
+func (d *DB) Search(query string) []SearchHit {
+	if strings.TrimSpace(query) == "" {
+		return nil
+	}
+	if !d.fts {
+		return d.searchTitles(query)
+	}
+
+	rows, err := d.db.Query(`
+		select rowid, highlight(articles_fts, 0, ?, ?) from articles_fts
+		where articles_fts match ? order by bm25(articles_fts, 10.0, 1.0, 5.0)`,
+		matchStart, matchEnd, FTSQuery(query),
+	)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	defer rows.Close()
+
+	hits := []SearchHit{}
+	for rows.Next() {
+		var h SearchHit
+		if err := rows.Scan(&h.ID, &h.Title); err != nil {
+			log.Println(err)
+			continue
+		}
+		hits = append(hits, h)
+	}
+	return hits
+}
+
+// searchTitles is used when full-text search isn't available. Matches
+// articles with any of the query words in the title.
+func (d *DB) searchTitles(query string) []SearchHit {
+	var words []string
+	for _, t := range splitQuery(strings.ToLower(query)) {
+		if i := strings.Index(t, ":"); i > 0 {
+			t = t[i+1:]
+		}
+		t = strings.Trim(t, `"*`)
+		if t != "" {
+			words = append(words, strings.Fields(t)...)
+		}
+	}
+
+	rows, err := d.db.Query("select id, title from articles where deleted = false order by published desc")
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	defer rows.Close()
+
+	hits := []SearchHit{}
+	for rows.Next() {
+		var (
+			id    int
+			title string
+		)
+		if err := rows.Scan(&id, &title); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		match := false
+		fields := strings.Fields(title)
+		for i, f := range fields {
+			for _, w := range words {
+				if strings.Contains(strings.ToLower(f), w) {
+					fields[i] = matchStart + f + matchEnd
+					match = true
+					break
+				}
+			}
+		}
+		if match {
+			hits = append(hits, SearchHit{ID: id, Title: strings.Join(fields, " ")})
+		}
+	}
+	return hits
+}
+
+// FTSQuery converts a search query as typed by the user to an FTS5 query.
+// Every term is quoted so that punctuation can't cause syntax errors,
+// while phrases, prefixes, field filters and AND/OR/NOT are kept.
+func FTSQuery(query string) string {
+	var terms []string
+	for _, t := range splitQuery(query) {
+		switch t {
+		case "AND", "OR", "NOT":
+			terms = append(terms, t)
+			continue
+		}
+
+		column := ""
+		if i := strings.Index(t, ":"); i > 0 && !strings.HasPrefix(t, `"`) {
+			switch strings.ToLower(t[:i]) {
+			case "title", "feed", "content":
+				column = strings.ToLower(t[:i]) + ":"
+				t = t[i+1:]
+			}
+		}
+
+		prefix := ""
+		if strings.HasSuffix(t, "*") {
+			prefix = "*"
+			t = strings.TrimSuffix(t, "*")
+		}
+
+		t = strings.Trim(t, `"`)
+		if t == "" {
+			continue
+		}
+		terms = append(terms, fmt.Sprintf(`%s"%s"%s`, column, strings.ReplaceAll(t, `"`, `""`), prefix))
+	}
+	return strings.Join(terms, " ")
+}
+
+// splitQuery splits a query on whitespace, keeping quoted phrases together
+func splitQuery(query string) []string {
+	var (
+		terms   []string
+		current strings.Builder
+		quoted  bool
+	)
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				terms = append(terms, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		terms = append(terms, current.String())
+	}
+	return terms
+}
+
+// HTMLToText converts the HTML content of an article to plain text
+func HTMLToText(content string) string {
+	text, err := html2text.FromString(content, html2text.Options{OmitLinks: true})
+	if err != nil {
+		return content
+	}
+	return text
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// searchPrefix is used for the feed name of a saved search in the feeds
+// window.
+const searchPrefix = "search:"
+
+// SavedSearch is a search query that is listed as a feed
+type SavedSearch struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// searchResult holds the hits of a search, and the titles with the matches
+// marked by id.
+type searchResult struct {
+	hits   []SearchHit
+	titles map[int]string
+}
+
+// runSavedSearches runs all saved searches against the database
+func (c *Controller) runSavedSearches() {
+	results := make(map[string]*searchResult)
+	for _, s := range c.conf.Searches {
+		r := &searchResult{hits: c.db.Search(s.Query), titles: make(map[int]string)}
+		for _, h := range r.hits {
+			r.titles[h.ID] = h.Title
+		}
+		results[s.Name] = r
+	}
+
+	c.searchLock.Lock()
+	c.savedSearches = results
+	c.searchLock.Unlock()
+}
+
+// SaveSearch saves a search query in the configuration file, replacing a
+// saved search with the same name.
+func (c *Controller) SaveSearch(name, query string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.TrimSpace(query) == "" {
+		return fmt.Errorf("a saved search needs a name and a query")
+	}
+
+	cf, err := LoadConfigFile(c.confFile)
+	if err != nil {
+		return err
+	}
+
+	searches := []SavedSearch{}
+	replaced := false
+	for _, s := range c.conf.Searches {
+		if strings.EqualFold(s.Name, name) {
+			s.Query = query
+			replaced = true
+		}
+		searches = append(searches, s)
+	}
+	if !replaced {
+		searches = append(searches, SavedSearch{Name: name, Query: query})
+	}
+
+	if err := cf.Set("searches", searches); err != nil {
+		return err
+	}
+	if err := cf.Save(); err != nil {
+		return err
+	}
+
+	c.conf.Searches = searches
+	c.runSavedSearches()
+	return nil
+}
+
+// searchHitsOf returns the search hits listed by a feed of the feeds window,
+// i.e. the search results or a saved search. The results are replaced, never
+// changed, by new searches so they can be used without holding the lock.
+func (c *Controller) searchHitsOf(feed string) ([]SearchHit, map[int]string, bool) {
+	c.searchLock.Lock()
+	defer c.searchLock.Unlock()
+
+	if feed == "result" {
+		return c.searchHits, c.searchTitles, true
+	}
+	if !strings.HasPrefix(feed, searchPrefix) {
+		return nil, nil, false
+	}
+	r, ok := c.savedSearches[strings.TrimPrefix(feed, searchPrefix)]
+	if !ok {
+		return nil, nil, true
+	}
+	return r.hits, r.titles, true
+}
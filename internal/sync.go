@@ -0,0 +1,439 @@
+package internal
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+)
+
+// lastSyncState is the name of the time of the last sync in sync_state
+const lastSyncState = "greader_last_sync"
+
+// syncArticle is the state of an article that exists on the sync server
+type syncArticle struct {
+	id             int
+	remoteID       string
+	read           bool
+	starred        bool
+	readChanged    time.Time
+	starredChanged time.Time
+	remoteUpdated  time.Time
+}
+
+// syncChange is a change of the state of articles, either to push to the
+// server or to apply locally.
+type syncChange struct {
+	ids []int
+	rem []string
+}
+
+func (s *syncChange) add(a syncArticle) {
+	s.ids = append(s.ids, a.id)
+	s.rem = append(s.rem, a.remoteID)
+}
+
+// Sync pulls the subscriptions and new articles from the GReader server,
+// pushes the read and starred changes made locally since the last sync and
+// applies those made on the server. If an article has changed on both sides
+// the newest change wins, the time an item last changed on the server is
+// fetched for that. The number of new articles is returned.
+func (c *Controller) Sync() (int, error) {
+	c.sLock.Lock()
+	defer c.sLock.Unlock()
+
+	if c.greader == nil {
+		c.greader = &GReader{URL: strings.TrimRight(c.conf.GReader.URL, "/"), Username: c.conf.GReader.Username, Password: c.conf.GReader.Password}
+		if err := c.greader.Login(); err != nil {
+			c.greader = nil
+			return 0, err
+		}
+	}
+	g := c.greader
+
+	start := time.Now().UTC()
+	lastSync, _ := time.Parse(time.RFC3339Nano, c.db.syncState(lastSyncState))
+
+	subs, err := g.Subscriptions()
+	if err != nil {
+		return 0, err
+	}
+	titles := c.setRemoteFeeds(subs)
+
+	// Pull the articles added since the last sync, with some margin for
+	// articles the server added while syncing.
+	since := start.AddDate(0, 0, -c.conf.SkipArticlesOlderThanDays)
+	if !lastSync.IsZero() && lastSync.Add(-time.Hour).After(since) {
+		since = lastSync.Add(-time.Hour)
+	}
+	ids, err := g.ItemIDs(greaderReadingList, "", since)
+	if err != nil {
+		return 0, err
+	}
+	known := c.db.remoteIDs()
+	var missing []string
+	for _, id := range ids {
+		if !known[id] {
+			missing = append(missing, id)
+		}
+	}
+	items, err := g.Items(missing)
+	if err != nil {
+		return 0, err
+	}
+
+	news := 0
+	var saved []Article
+	defer func() { go c.runHooks(saved) }()
+	for _, item := range items {
+		feed := titles[item.Origin.StreamID]
+		if feed == "" {
+			feed = item.Origin.Title
+		}
+		guid := item.Link()
+		if guid == "" {
+			guid = item.ID
+		}
+		// Feeds that are also fetched locally use the guids of the feed,
+		// find the article by its link so that it isn't stored twice.
+		if local, ok := c.db.guidByLink(feed, item.Link()); ok {
+			guid = local
+		}
+		a := Article{
+			c:         c,
+			guid:      guid,
+			feed:      feed,
+			title:     item.Title,
+			content:   item.HTML(),
+			link:      item.Link(),
+			published: time.Unix(item.Published, 0),
+			author:    item.Author,
+		}
+		if !c.applyRules(&a) {
+			continue
+		}
+		added, err := c.db.Save(&a)
+		if err != nil {
+			return news, err
+		}
+		if added && !a.read && !a.deleted {
+			news++
+			a.highlight = c.isHighlight(&a)
+			saved = append(saved, a)
+		}
+		if err := c.db.setRemote(a, item.ID, item.Modified()); err != nil {
+			return news, err
+		}
+	}
+
+	// Compare the read and starred state of all articles
+	unreadIDs, err := g.ItemIDs(greaderReadingList, greaderRead, time.Time{})
+	if err != nil {
+		return news, err
+	}
+	starredIDs, err := g.ItemIDs(greaderStarred, "", time.Time{})
+	if err != nil {
+		return news, err
+	}
+	unread := make(map[string]bool)
+	for _, id := range unreadIDs {
+		unread[id] = true
+	}
+	starred := make(map[string]bool)
+	for _, id := range starredIDs {
+		starred[id] = true
+	}
+
+	// Articles that differ from the server and have changed locally since
+	// the last sync may have changed on the server too, fetch when they
+	// last changed there.
+	articles := c.db.syncArticles()
+	var conflicts []string
+	for _, a := range articles {
+		if (a.read == unread[a.remoteID] && a.readChanged.After(lastSync)) ||
+			(a.starred != starred[a.remoteID] && a.starredChanged.After(lastSync)) {
+			conflicts = append(conflicts, a.remoteID)
+		}
+	}
+	updated := make(map[string]time.Time)
+	if len(conflicts) > 0 {
+		items, err := g.Items(conflicts)
+		if err != nil {
+			return news, err
+		}
+		for _, item := range items {
+			updated[item.ID] = item.Modified()
+			if err := c.db.setRemoteUpdated(item.ID, item.Modified()); err != nil {
+				return news, err
+			}
+		}
+	}
+
+	// Changes to push (local wins) and to apply (server wins)
+	var pushRead, pushUnread, pushStar, pushUnstar syncChange
+	var read, unreadLocal, star, unstar syncChange
+	for _, a := range articles {
+		if t, ok := updated[a.remoteID]; ok {
+			a.remoteUpdated = t
+		}
+		remoteRead := !unread[a.remoteID]
+		if a.read != remoteRead {
+			local := a.readChanged.After(lastSync) && a.readChanged.After(a.remoteUpdated)
+			switch {
+			case local && a.read:
+				pushRead.add(a)
+			case local:
+				pushUnread.add(a)
+			case remoteRead:
+				read.add(a)
+			default:
+				unreadLocal.add(a)
+			}
+		}
+
+		remoteStarred := starred[a.remoteID]
+		if a.starred != remoteStarred {
+			local := a.starredChanged.After(lastSync) && a.starredChanged.After(a.remoteUpdated)
+			switch {
+			case local && a.starred:
+				pushStar.add(a)
+			case local:
+				pushUnstar.add(a)
+			case remoteStarred:
+				star.add(a)
+			default:
+				unstar.add(a)
+			}
+		}
+	}
+
+	for _, p := range []struct {
+		change *syncChange
+		tag    string
+		add    bool
+	}{
+		{&pushRead, greaderRead, true},
+		{&pushUnread, greaderRead, false},
+		{&pushStar, greaderStarred, true},
+		{&pushUnstar, greaderStarred, false},
+	} {
+		if err := g.EditTag(p.change.rem, p.tag, p.add); err != nil {
+			return news, err
+		}
+	}
+
+	for _, a := range []struct {
+		change *syncChange
+		apply  func(a *Article)
+	}{
+		{&read, func(a *Article) { a.read = true }},
+		{&unreadLocal, func(a *Article) { a.read = false }},
+		{&star, func(a *Article) { a.starred = true }},
+		{&unstar, func(a *Article) { a.starred = false }},
+	} {
+		if len(a.change.ids) == 0 {
+			continue
+		}
+		apply := a.apply
+		err := c.changeArticles(a.change.ids, func(articles []*Article) error {
+			for _, a := range articles {
+				apply(a)
+				if err := c.db.setSyncedState(a); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return news, err
+		}
+	}
+
+	c.db.setSyncState(lastSyncState, start.Format(time.RFC3339Nano))
+
+	pushed := len(pushRead.ids) + len(pushUnread.ids) + len(pushStar.ids) + len(pushUnstar.ids)
+	pulled := len(read.ids) + len(unreadLocal.ids) + len(star.ids) + len(unstar.ids)
+	log.Printf("Synced with %s: %d new articles, %d changes pushed, %d changes pulled", g.URL, news, pushed, pulled)
+	return news, nil
+}
+
+// syncDue returns true if it's time to sync with the GReader server
+func (c *Controller) syncDue(now time.Time) bool {
+	c.rLock.Lock()
+	defer c.rLock.Unlock()
+
+	if c.conf.GReader.URL == "" || now.Before(c.nextSync) {
+		return false
+	}
+
+	interval := c.conf.GReader.Interval
+	if interval <= 0 {
+		interval = c.conf.SecondsBetweenUpdates
+	}
+	if interval <= 0 {
+		interval = 300
+	}
+	c.nextSync = now.Add(time.Duration(interval) * time.Second)
+	return true
+}
+
+// setRemoteFeeds replaces the remote feeds with the subscriptions on the
+// server. Feeds that are also in the configuration are fetched as usual.
+// The feed titles are returned by stream id.
+func (c *Controller) setRemoteFeeds(subs []GReaderSubscription) map[string]string {
+	c.rLock.Lock()
+	defer c.rLock.Unlock()
+
+	titles := make(map[string]string)
+	local := make(map[string]bool)
+	feeds := []Feed{}
+	for _, f := range c.Feeds() {
+		if !f.Remote {
+			local[f.URL] = true
+			feeds = append(feeds, f)
+		}
+	}
+
+	c.remoteFeeds = nil
+	for _, s := range subs {
+		url := s.URL
+		if url == "" {
+			url = strings.TrimPrefix(s.ID, "feed/")
+		}
+		titles[s.ID] = s.Title
+
+		if local[url] {
+			// Articles are stored with the title of the fetched feed
+			if title := c.rss.Title(url); title != "" {
+				titles[s.ID] = title
+			}
+			continue
+		}
+		f := Feed{URL: url, Remote: true}
+		if len(s.Categories) > 0 {
+			f.Category = s.Categories[0].Label
+		}
+		c.remoteFeeds = append(c.remoteFeeds, f)
+
+		c.rss.tLock.Lock()
+		c.rss.titles[url] = s.Title
+		c.rss.tLock.Unlock()
+		c.db.SaveFeedCache(url, s.Title, s.HTMLURL, "", "")
+	}
+
+	c.setFeeds(append(feeds, c.remoteFeeds...))
+	return titles
+}
+
+// syncArticles returns the state of all articles that exist on the sync server
+func (d *DB) syncArticles() []syncArticle {
+	rows, err := d.db.Query(`
+		select id, remote_id, read, starred, read_changed, starred_changed, remote_updated
+		from articles where remote_id is not null and deleted = false`)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	defer rows.Close()
+
+	var articles []syncArticle
+	for rows.Next() {
+		var a syncArticle
+		var readChanged, starredChanged, remoteUpdated sql.NullTime
+		if err := rows.Scan(&a.id, &a.remoteID, &a.read, &a.starred, &readChanged, &starredChanged, &remoteUpdated); err != nil {
+			log.Println(err)
+			continue
+		}
+		a.readChanged = readChanged.Time
+		a.starredChanged = starredChanged.Time
+		a.remoteUpdated = remoteUpdated.Time
+		articles = append(articles, a)
+	}
+	return articles
+}
+
+// remoteIDs returns the remote ids of all articles from the sync server
+func (d *DB) remoteIDs() map[string]bool {
+	ids := make(map[string]bool)
+
+	rows, err := d.db.Query("select remote_id from articles where remote_id is not null")
+	if err != nil {
+		log.Println(err)
+		return ids
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			log.Println(err)
+			continue
+		}
+		ids[id] = true
+	}
+	return ids
+}
+
+// setRemote stores the remote id of an article and when it last changed on
+// the sync server.
+func (d *DB) setRemote(a Article, remoteID string, updated time.Time) error {
+	_, err := d.db.Exec("update articles set remote_id = ?, remote_updated = ? where feed = ? and guid = ?", remoteID, updated, a.feed, a.guid)
+	if err != nil {
+		log.Println(err)
+	}
+	return err
+}
+
+// setRemoteUpdated stores when an article last changed on the sync server
+func (d *DB) setRemoteUpdated(remoteID string, updated time.Time) error {
+	_, err := d.db.Exec("update articles set remote_updated = ? where remote_id = ?", updated, remoteID)
+	if err != nil {
+		log.Println(err)
+	}
+	return err
+}
+
+// guidByLink returns the guid of an article of a feed with the given link
+func (d *DB) guidByLink(feed, link string) (string, bool) {
+	if link == "" {
+		return "", false
+	}
+	var guid string
+	err := d.db.QueryRow("select guid from articles where feed = ? and link = ? limit 1", feed, link).Scan(&guid)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println(err)
+		}
+		return "", false
+	}
+	return guid, true
+}
+
+// setSyncedState stores the read and starred state of an article as
+// received from the sync server. Unlike local changes the time of the
+// change isn't recorded, so that it isn't pushed back.
+func (d *DB) setSyncedState(a *Article) error {
+	_, err := d.db.Exec("update articles set read = ?, starred = ? where id = ?", a.read, a.starred, a.id)
+	if err != nil {
+		log.Println(err)
+	}
+	return err
+}
+
+// syncState returns a value stored in sync_state
+func (d *DB) syncState(name string) string {
+	var value sql.NullString
+	err := d.db.QueryRow("select value from sync_state where name = ?", name).Scan(&value)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err)
+	}
+	return value.String
+}
+
+// setSyncState stores a value in sync_state
+func (d *DB) setSyncState(name, value string) {
+	_, err := d.db.Exec("insert into sync_state(name, value) values(?, ?) on conflict(name) do update set value = excluded.value", name, value)
+	if err != nil {
+		log.Println(err)
+	}
+}
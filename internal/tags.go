@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"sort"
+	"strings"
+)
+
+// tagPrefix is used for the feed name of a tag in the feeds window
+const tagPrefix = "tag:"
+
+// ParseTags splits a comma separated list of tags. Surrounding spaces and
+// empty tags are removed, as are tags given more than once, ignoring case.
+func ParseTags(s string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[strings.ToLower(t)] {
+			continue
+		}
+		seen[strings.ToLower(t)] = true
+		tags = append(tags, t)
+	}
+	return tags
+}
+
+// SetTags replaces the tags of an article
+func (c *Controller) SetTags(a *Article, tags []string) error {
+	old := a.tags
+	a.tags = tags
+	if err := c.db.SetTags(a); err != nil {
+		a.tags = old
+		return err
+	}
+	return nil
+}
+
+// articleTags returns the tags of the articles in the feeds window, with the
+// number of unread and all articles of each. Tags that only differ in case
+// are counted as one.
+func (c *Controller) articleTags() (names []string, unread, total map[string]int) {
+	unread = make(map[string]int)
+	total = make(map[string]int)
+	spelling := make(map[string]string)
+	for _, a := range c.articles {
+		for _, t := range a.tags {
+			if s, ok := spelling[strings.ToLower(t)]; ok {
+				t = s
+			} else {
+				spelling[strings.ToLower(t)] = t
+				names = append(names, t)
+			}
+			total[t]++
+			if !a.read {
+				unread[t]++
+			}
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+	return names, unread, total
+}
+
+// completeTag returns the tags in the database that complete the last tag of
+// a comma separated list, leaving out tags that are already in the list.
+func (c *Controller) completeTag(text string) []string {
+	given := strings.Split(text, ",")
+	last := strings.ToLower(strings.TrimSpace(given[len(given)-1]))
+	if last == "" {
+		return nil
+	}
+
+	inList := make(map[string]bool)
+	for _, t := range given {
+		inList[strings.ToLower(strings.TrimSpace(t))] = true
+	}
+
+	var entries []string
+	for t := range c.db.AllTags() {
+		if strings.HasPrefix(strings.ToLower(t), last) && !inList[strings.ToLower(t)] {
+			entries = append(entries, t)
+		}
+	}
+	sort.Strings(entries)
+	return entries
+}
@@ -27,6 +27,9 @@ type Theme struct {
 	PreviewLink        string   `json:"previewLink"`
 	UnreadMarker       string   `json:"unreadMarker"`
 	LinkMarker         string   `json:"linkMarker"`
+	StarredMarker      string   `json:"starredMarker"`
+	WarningMarker      string   `json:"warningMarker"`
+	Warning            string   `json:"warning"`
 	FeedIcon           string   `json:"feedIcon"`
 	ArticleIcon        string   `json:"articleIcon"`
 	PreviewIcon        string   `json:"previewIcon"`
@@ -34,6 +37,7 @@ type Theme struct {
 	StatusText         string   `json:"statusText"`
 	StatusKey          string   `json:"statusKey"`
 	StatusBrackets     string   `json:"statusBrackets"`
+	Tags               string   `json:"tags"`
 }
 
 // LoadTheme loads a theme file and parses it.
@@ -52,5 +56,10 @@ func LoadTheme(file string) Theme {
 		log.Fatal("Failed to parse theme file:", err)
 	}
 
+	// Themes from before tags were added
+	if theme.Tags == "" {
+		theme.Tags = theme.Highlights
+	}
+
 	return theme
 }
@@ -3,6 +3,7 @@ package internal
 import (
 	"fmt"
 	"log"
+	"net/url"
 	"regexp"
 	"sort"
 	"strconv"
@@ -21,6 +22,7 @@ type Window struct {
 	articles    *tview.Table
 	status      *tview.Table
 	help        *tview.Table
+	errors      *tview.Table
 	preview     *tview.TextView
 	app         *tview.Application
 	theme       *Theme
@@ -31,12 +33,20 @@ type Window struct {
 	layout      *tview.Flex
 	showPreview bool
 	showHelp    bool
+	showErrors  bool
 	nArticles   int
 	nFeeds      int
 	askQuit     bool
 	currSearch  string
+	message     string
+	messageTime time.Time
+	// links are the numbered links of the article in the preview
+	links []string
 }
 
+// messageTimeout is how long a status message is shown
+const messageTimeout = 10 * time.Second
+
 const (
 	// KeyCell -
 	KeyCell = iota
@@ -112,6 +122,14 @@ func (w *Window) Init(inputFunc func(*tcell.EventKey) *tcell.EventKey, c *Contro
 		w.help.SetCell(i, ActionCell, ts)
 	}
 
+	// Feed errors window
+	w.errors = tview.NewTable()
+	w.errors.SetTitleAlign(tview.AlignLeft)
+	w.errors.SetBorder(true)
+	w.errors.SetBorderPadding(1, 1, 1, 1)
+	w.errors.SetBorderColor(tcell.GetColor(w.c.theme.ArticleBorder))
+	w.errors.SetTitle(fmt.Sprintf("%s Feed Errors", w.WarningMarker())).SetTitleColor(tcell.GetColor(w.c.theme.ArticleBorderTitle))
+
 	// Preview window
 	w.preview = tview.NewTextView()
 	w.preview.SetBorder(true)
@@ -127,7 +145,7 @@ func (w *Window) Init(inputFunc func(*tcell.EventKey) *tcell.EventKey, c *Contro
 	w.status.SetBackgroundColor(tcell.GetColor(w.c.theme.StatusBackground))
 	w.status.SetFixed(1, 6)
 
-	for i := 0; i < 7; i++ {
+	for i := 0; i < 8; i++ {
 		ts = tview.NewTableCell("")
 		ts.SetAlign(tview.AlignLeft)
 		ts.Attributes |= tcell.AttrBold
@@ -187,6 +205,9 @@ func (w *Window) Start() {
 
 // ToggleHelp shows/hides the keyboard shortchuts
 func (w *Window) ToggleHelp() {
+	if w.showErrors {
+		w.ToggleErrors()
+	}
 	if !w.showHelp {
 		w.flexMiddle = w.flexMiddle.RemoveItem(w.preview)
 		w.flexMiddle = w.flexMiddle.RemoveItem(w.articles)
@@ -200,6 +221,99 @@ func (w *Window) ToggleHelp() {
 	}
 }
 
+// ToggleErrors shows/hides the fetch errors of all feeds
+func (w *Window) ToggleErrors() {
+	if w.showHelp {
+		w.ToggleHelp()
+	}
+	if !w.showErrors {
+		w.UpdateErrors()
+		w.flexMiddle = w.flexMiddle.RemoveItem(w.preview)
+		w.flexMiddle = w.flexMiddle.RemoveItem(w.articles)
+		w.flexMiddle = w.flexMiddle.AddItem(w.errors, 0, 1, false)
+		w.showErrors = true
+	} else {
+		w.flexMiddle = w.flexMiddle.AddItem(w.articles, 0, 5, false)
+		w.flexMiddle = w.flexMiddle.AddItem(w.preview, 0, 1, false)
+		w.flexMiddle = w.flexMiddle.RemoveItem(w.errors)
+		w.showErrors = false
+	}
+}
+
+// UpdateErrors fills the errors window with the health of each feed
+func (w *Window) UpdateErrors() {
+	w.errors.Clear()
+
+	for i, h := range []string{"Feed", "Failures", "Last Success", "Last Error"} {
+		ts := tview.NewTableCell(h)
+		ts.SetAlign(tview.AlignLeft)
+		ts.Attributes |= tcell.AttrBold
+		ts.SetTextColor(tcell.GetColor(w.c.theme.TableHead))
+		ts.SetSelectable(false)
+		w.errors.SetCell(0, i, ts)
+	}
+
+	health := w.c.sched.Health()
+	row := 1
+	for _, f := range w.c.Feeds() {
+		h, ok := health[f.URL]
+		if !ok {
+			continue
+		}
+
+		name := f.Name
+		if name == "" {
+			name = w.c.rss.Title(f.URL)
+		}
+		if name == "" {
+			name = f.URL
+		}
+
+		color := w.c.theme.StatusText
+		if h.Failures > 0 {
+			color = w.c.theme.Warning
+		}
+
+		lastSuccess := "never"
+		if !h.LastSuccess.IsZero() {
+			lastSuccess = h.LastSuccess.Format("2006-01-02 15:04:05")
+		}
+
+		for i, text := range []string{name, fmt.Sprintf("%d", h.Failures), lastSuccess, h.LastError} {
+			ts := tview.NewTableCell(tview.Escape(text))
+			ts.SetAlign(tview.AlignLeft)
+			ts.SetTextColor(tcell.GetColor(color))
+			ts.SetSelectable(false)
+			if i == 0 {
+				ts.SetMaxWidth(30)
+			}
+			w.errors.SetCell(row, i, ts)
+		}
+		row++
+
+		// List the recent errors below each failing feed
+		if h.Failures == 0 {
+			continue
+		}
+		for j := len(h.Errors) - 1; j >= 0; j-- {
+			ts := tview.NewTableCell(tview.Escape("  " + h.Errors[j]))
+			ts.SetAlign(tview.AlignLeft)
+			ts.SetTextColor(tcell.GetColor(w.c.theme.PreviewText))
+			ts.SetSelectable(false)
+			w.errors.SetCell(row, 3, ts)
+			row++
+		}
+	}
+}
+
+// WarningMarker returns the marker used for feeds that fail to update
+func (w *Window) WarningMarker() string {
+	if w.c.theme.WarningMarker != "" {
+		return w.c.theme.WarningMarker
+	}
+	return "!"
+}
+
 // TogglePreview shows/hides the preview window for an article
 func (w *Window) TogglePreview() {
 	if !w.showPreview {
@@ -243,6 +357,7 @@ func (w *Window) Search() {
 		}
 
 		if strings.EqualFold(keyName, "esc") {
+			w.askQuit = false
 			w.flexStatus.RemoveItem(inputField)
 			w.flexStatus.AddItem(w.status, 1, 1, false)
 			w.app.SetInputCapture(w.c.Input)
@@ -250,16 +365,131 @@ func (w *Window) Search() {
 		}
 
 		if strings.EqualFold(keyName, "enter") {
+			w.askQuit = false
 			w.flexStatus.RemoveItem(inputField)
 			w.flexStatus.AddItem(w.status, 1, 1, false)
 			w.app.SetInputCapture(w.c.Input)
 			w.app.SetFocus(w.articles)
 
+			w.currSearch = inputField.GetText()
+			w.c.Search(w.currSearch)
 			w.feeds.Select(2, 0)
 			w.articles.Select(0, 3)
+		}
 
-		} else {
-			w.currSearch += keyName
+		return e
+	}
+	w.flexStatus.AddItem(inputField, 1, 0, false)
+	w.app.SetFocus(inputField)
+	w.app.SetInputCapture(capt)
+}
+
+// SaveSearch asks the user for a name to save the current search as
+func (w *Window) SaveSearch() {
+	if w.currSearch == "" {
+		w.StatusMessage("No search to save, search first")
+		return
+	}
+	query := w.currSearch
+	w.askQuit = true
+	w.flexStatus.RemoveItem(w.status)
+
+	inputField := tview.NewInputField().
+		SetLabel(fmt.Sprintf("save search %s as: ", tview.Escape(strconv.Quote(query)))).
+		SetFieldWidth(30).
+		SetFieldBackgroundColor(tcell.ColorBlack)
+
+	capt := func(e *tcell.EventKey) *tcell.EventKey {
+		keyName := string(e.Name())
+		if strings.Contains(keyName, "Rune") {
+			keyName = string(e.Rune())
+		}
+
+		if strings.EqualFold(keyName, "esc") || strings.EqualFold(keyName, "enter") {
+			w.askQuit = false
+			w.flexStatus.RemoveItem(inputField)
+			w.flexStatus.AddItem(w.status, 1, 1, false)
+			w.app.SetInputCapture(w.c.Input)
+			w.app.SetFocus(w.articles)
+		}
+
+		if strings.EqualFold(keyName, "enter") {
+			name := strings.TrimSpace(inputField.GetText())
+			if err := w.c.SaveSearch(name, query); err != nil {
+				w.StatusMessage(fmt.Sprintf("Failed to save search: %v", err))
+			} else {
+				w.StatusMessage(fmt.Sprintf("Saved search %s", name))
+				w.c.ShowFeeds()
+			}
+		}
+
+		return e
+	}
+	w.flexStatus.AddItem(inputField, 1, 0, false)
+	w.app.SetFocus(inputField)
+	w.app.SetInputCapture(capt)
+}
+
+// TagPrompt asks the user for the tags of an article, as a comma separated
+// list. The tags in the database are completed with tab.
+func (w *Window) TagPrompt(a *Article) {
+	w.askQuit = true
+	w.flexStatus.RemoveItem(w.status)
+
+	// completing is true while the completions are shown, enter then picks
+	// a completion instead of saving the tags.
+	completing := false
+	inputField := tview.NewInputField().
+		SetLabel("tags: ").
+		SetFieldWidth(50).
+		SetFieldBackgroundColor(tcell.ColorBlack)
+	inputField.SetAutocompleteFunc(func(text string) []string {
+		entries := w.c.completeTag(text)
+		completing = len(entries) > 0
+		return entries
+	})
+	inputField.SetAutocompletedFunc(func(tag string, index, source int) bool {
+		if source == tview.AutocompletedNavigate {
+			return false
+		}
+		text := inputField.GetText()
+		text = text[:strings.LastIndex(text, ",")+1]
+		if text != "" {
+			text += " "
+		}
+		inputField.SetText(text + tag + ", ")
+		completing = false
+		return true
+	})
+	if len(a.tags) > 0 {
+		inputField.SetText(strings.Join(a.tags, ", ") + ", ")
+	}
+
+	capt := func(e *tcell.EventKey) *tcell.EventKey {
+		keyName := string(e.Name())
+		if strings.Contains(keyName, "Rune") {
+			keyName = string(e.Rune())
+		}
+
+		if completing && (strings.EqualFold(keyName, "esc") || strings.EqualFold(keyName, "enter")) {
+			completing = false
+			return e
+		}
+
+		if strings.EqualFold(keyName, "esc") || strings.EqualFold(keyName, "enter") {
+			w.askQuit = false
+			w.flexStatus.RemoveItem(inputField)
+			w.flexStatus.AddItem(w.status, 1, 1, false)
+			w.app.SetInputCapture(w.c.Input)
+			w.app.SetFocus(w.articles)
+		}
+
+		if strings.EqualFold(keyName, "enter") {
+			if err := w.c.SetTags(a, ParseTags(inputField.GetText())); err != nil {
+				w.StatusMessage(fmt.Sprintf("Failed to tag article: %v", err))
+			} else {
+				w.c.ShowArticles(w.c.activeFeed)
+			}
 		}
 
 		return e
@@ -269,6 +499,126 @@ func (w *Window) Search() {
 	w.app.SetInputCapture(capt)
 }
 
+// LinkPrompt asks the user for the number of a link in the preview to open.
+// The number can be prefixed with m to mark the link instead, or c to copy
+// it.
+func (w *Window) LinkPrompt() {
+	if len(w.links) == 0 {
+		w.StatusMessage("No links in the preview")
+		return
+	}
+	w.askQuit = true
+	w.flexStatus.RemoveItem(w.status)
+
+	inputField := tview.NewInputField().
+		SetLabel(fmt.Sprintf("link 1-%d (m<n> mark, c<n> copy): ", len(w.links))).
+		SetFieldWidth(10).
+		SetFieldBackgroundColor(tcell.ColorBlack)
+
+	capt := func(e *tcell.EventKey) *tcell.EventKey {
+		keyName := string(e.Name())
+		if strings.Contains(keyName, "Rune") {
+			keyName = string(e.Rune())
+		}
+
+		if strings.EqualFold(keyName, "esc") || strings.EqualFold(keyName, "enter") {
+			w.askQuit = false
+			w.flexStatus.RemoveItem(inputField)
+			w.flexStatus.AddItem(w.status, 1, 1, false)
+			w.app.SetInputCapture(w.c.Input)
+			w.app.SetFocus(w.articles)
+		}
+
+		if strings.EqualFold(keyName, "enter") {
+			w.c.PreviewLink(inputField.GetText())
+		}
+
+		return e
+	}
+	w.flexStatus.AddItem(inputField, 1, 0, false)
+	w.app.SetFocus(inputField)
+	w.app.SetInputCapture(capt)
+}
+
+// AddFeed asks the user to input the URL of a feed, or a web page with a
+// feed, to add.
+func (w *Window) AddFeed() {
+	w.askQuit = true
+	w.flexStatus.RemoveItem(w.status)
+
+	inputField := tview.NewInputField().
+		SetLabel("add feed: ").
+		SetFieldWidth(60).
+		SetFieldBackgroundColor(tcell.ColorBlack)
+
+	capt := func(e *tcell.EventKey) *tcell.EventKey {
+		keyName := string(e.Name())
+		if strings.Contains(keyName, "Rune") {
+			keyName = string(e.Rune())
+		}
+
+		if strings.EqualFold(keyName, "esc") || strings.EqualFold(keyName, "enter") {
+			w.askQuit = false
+			w.flexStatus.RemoveItem(inputField)
+			w.flexStatus.AddItem(w.status, 1, 1, false)
+			w.app.SetInputCapture(w.c.Input)
+			w.app.SetFocus(w.articles)
+		}
+
+		if strings.EqualFold(keyName, "enter") {
+			if url := strings.TrimSpace(inputField.GetText()); url != "" {
+				w.c.AddFeedURL(url)
+			}
+		}
+
+		return e
+	}
+	w.flexStatus.AddItem(inputField, 1, 0, false)
+	w.app.SetFocus(inputField)
+	w.app.SetInputCapture(capt)
+}
+
+// ChooseFeed lets the user choose one of the feeds found on a web page.
+// The chosen feed is passed to selected.
+func (w *Window) ChooseFeed(page string, candidates []string, selected func(url string)) {
+	list := tview.NewList().ShowSecondaryText(false)
+	list.SetBorder(true)
+	list.SetBorderPadding(1, 1, 1, 1)
+	list.SetBorderColor(tcell.GetColor(w.c.theme.ArticleBorder))
+	list.SetTitleAlign(tview.AlignLeft)
+	list.SetTitle(fmt.Sprintf("Feeds of %s", page)).SetTitleColor(tcell.GetColor(w.c.theme.ArticleBorderTitle))
+
+	done := func() {
+		w.flexMiddle.RemoveItem(list)
+		w.flexMiddle.AddItem(w.articles, 0, w.c.conf.ArticleWindowSizeRatio, false)
+		if w.showPreview {
+			w.flexMiddle.AddItem(w.preview, 0, w.c.conf.PreviewWindowSizeRatio, false)
+		}
+		w.app.SetInputCapture(w.c.Input)
+		w.app.SetFocus(w.articles)
+	}
+
+	for i, c := range candidates {
+		url := c
+		shortcut := rune(0)
+		if i < 9 {
+			shortcut = rune('1' + i)
+		}
+		list.AddItem(url, "", shortcut, func() {
+			done()
+			selected(url)
+		})
+	}
+	list.SetDoneFunc(done)
+
+	w.flexMiddle.RemoveItem(w.articles)
+	w.flexMiddle.RemoveItem(w.preview)
+	w.flexMiddle.AddItem(list, 0, 1, false)
+	// The list handles the keys itself while it is shown
+	w.app.SetInputCapture(nil)
+	w.app.SetFocus(list)
+}
+
 // AskQuit asks the user to quit or not.
 func (w *Window) AskQuit() {
 	w.askQuit = true
@@ -289,6 +639,7 @@ func (w *Window) AskQuit() {
 			w.c.quit <- 1
 		}
 
+		w.askQuit = false
 		w.flexStatus.RemoveItem(inputField)
 		w.flexStatus.AddItem(w.status, 1, 1, false)
 		w.app.SetInputCapture(w.c.Input)
@@ -402,11 +753,27 @@ func (w *Window) StatusUpdate() {
 		),
 	)
 
+	c = w.status.GetCell(0, 7)
+	if w.message != "" && time.Since(w.messageTime) < messageTimeout {
+		c.SetText(fmt.Sprintf("[%s]%s", w.c.theme.StatusText, tview.Escape(w.message)))
+	} else {
+		c.SetText("")
+	}
+
 	go w.app.Draw()
 }
 
+// StatusMessage shows a message in the status bar for a while
+func (w *Window) StatusMessage(msg string) {
+	w.message = msg
+	w.messageTime = time.Now()
+	log.Println(msg)
+	w.StatusUpdate()
+}
+
 // ClearPreview clears the preview window
 func (w *Window) ClearPreview() {
+	w.links = nil
 	w.preview.Clear()
 }
 
@@ -473,21 +840,12 @@ func (w *Window) ClearFeeds() {
 	w.feeds.SetSelectable(true, false)
 }
 
-// AddToFeeds add a new feed to the feed window
-func (w *Window) AddToFeeds(name, displayName string, unread, total int, ref *Article) {
+// AddToFeeds add a new feed to the feed window. Feeds that fail to update
+// are shown with a warning marker.
+func (w *Window) AddToFeeds(name, displayName string, unread, total int, failing bool, ref *Article) {
 	w.nFeeds++
 
-	color := "white"
-	if len(w.c.conf.Feeds) < len(w.c.theme.FeedNames) {
-		idx := 0
-		for i, f := range w.c.rss.feeds {
-			if f.feed.Title == name {
-				idx = i
-				break
-			}
-		}
-		color = w.c.theme.FeedNames[idx]
-	}
+	color := w.FeedColor(name)
 
 	// Display total number of articles
 	nc := tview.NewTableCell(fmt.Sprintf("%d", total))
@@ -507,6 +865,9 @@ func (w *Window) AddToFeeds(name, displayName string, unread, total int, ref *Ar
 	if displayName == "" {
 		displayName = name
 	}
+	if failing {
+		displayName = fmt.Sprintf("[%s]%s [%s]%s", w.c.theme.Warning, w.WarningMarker(), color, displayName)
+	}
 	nc = tview.NewTableCell(fmt.Sprintf("%s", displayName))
 	nc.SetAlign(tview.AlignLeft)
 	w.feeds.SetCell(w.nFeeds, 2, nc)
@@ -515,6 +876,44 @@ func (w *Window) AddToFeeds(name, displayName string, unread, total int, ref *Ar
 	nc.SetReference(ref)
 }
 
+// FeedColor returns the theme color for a feed. Colors are only used if the
+// theme has enough colors for all feeds.
+func (w *Window) FeedColor(name string) string {
+	if len(w.c.Feeds()) < len(w.c.theme.FeedNames) {
+		return w.c.theme.FeedNames[w.c.rss.FeedIndex(name)]
+	}
+	return "white"
+}
+
+// AddCategoryToFeeds adds a category to the feed window with the number of
+// unread and total articles of all its feeds.
+func (w *Window) AddCategoryToFeeds(name string, collapsed bool, unread, total int, ref *Article) {
+	w.nFeeds++
+
+	nc := tview.NewTableCell(fmt.Sprintf("%d", total))
+	nc.SetAlign(tview.AlignLeft)
+	nc.Attributes |= tcell.AttrBold
+	nc.SetTextColor(tcell.GetColor(w.c.theme.TotalColumn))
+	w.feeds.SetCell(w.nFeeds, 0, nc)
+
+	nc = tview.NewTableCell(fmt.Sprintf("%d", unread))
+	nc.SetAlign(tview.AlignLeft)
+	nc.Attributes |= tcell.AttrBold
+	nc.SetTextColor(tcell.GetColor(w.c.theme.UnreadColumn))
+	w.feeds.SetCell(w.nFeeds, 1, nc)
+
+	marker := "▾"
+	if collapsed {
+		marker = "▸"
+	}
+	nc = tview.NewTableCell(fmt.Sprintf("%s %s", marker, tview.Escape(name)))
+	nc.SetAlign(tview.AlignLeft)
+	nc.Attributes |= tcell.AttrBold
+	nc.SetTextColor(tcell.GetColor(w.c.theme.TableHead))
+	nc.SetReference(ref)
+	w.feeds.SetCell(w.nFeeds, 2, nc)
+}
+
 // ArticlesHasFocus returns true if the aricles window has focus
 func (w *Window) ArticlesHasFocus() bool {
 	if w.app.GetFocus() == w.articles {
@@ -536,7 +935,7 @@ func (w *Window) MoveDown(focus tview.Primitive) {
 		}
 
 		if r == 1 {
-			w.c.db.MarkRead(a)
+			w.c.db.MarkSelected(a)
 			a.read = true
 		}
 		if r < count-1 {
@@ -607,6 +1006,15 @@ func (w *Window) SelectPreviewWindow() {
 	w.app.SetFocus(w.preview)
 }
 
+// tagsText returns the tags of an article to show after its title
+func (w *Window) tagsText(a *Article) string {
+	var tags []string
+	for _, t := range a.tags {
+		tags = append(tags, "#"+tview.Escape(t))
+	}
+	return fmt.Sprintf(" [%s]%s", w.c.theme.Tags, strings.Join(tags, " "))
+}
+
 // AddToArticles adds an article to the article window
 func (w *Window) AddToArticles(a *Article, markedWeb bool) {
 	if a == nil {
@@ -620,17 +1028,7 @@ func (w *Window) AddToArticles(a *Article, markedWeb bool) {
 	nc.SetSelectable(false)
 
 	// Create different color per feed name
-	color := "white"
-	if len(w.c.conf.Feeds) < len(w.c.theme.FeedNames) {
-		idx := 0
-		for i, f := range w.c.rss.feeds {
-			if f.feed.Title == a.feed {
-				idx = i
-				break
-			}
-		}
-		color = w.c.theme.FeedNames[idx]
-	}
+	color := w.FeedColor(a.feed)
 	fc := tview.NewTableCell(fmt.Sprintf("[%s]%s", color, a.feed))
 	fc.SetTextColor(tcell.GetColor(color))
 	fc.SetAlign(tview.AlignLeft)
@@ -645,44 +1043,20 @@ func (w *Window) AddToArticles(a *Article, markedWeb bool) {
 	tc.SetReference(a)
 	w.articles.SetCell(w.nArticles, 2, tc)
 
-	if w.c.activeFeed == "result" {
-		hTitle := ""
-		fields := strings.Fields(a.title)
-		for _, f := range fields {
-			found := false
-			for _, h := range strings.Fields(w.currSearch) {
-				if strings.Contains(strings.ToLower(f), strings.ToLower(h)) {
-					found = true
-				}
-			}
-			if found {
-				hTitle += fmt.Sprintf("[%s]"+f+" [%s]", w.c.theme.Highlights, w.c.theme.Title)
-			} else {
-				hTitle += f + " "
-			}
-		}
+	_, titles, _ := w.c.searchHitsOf(w.c.activeFeed)
+	if hTitle, ok := titles[a.id]; ok {
+		// Matches are marked by the search
+		hTitle = tview.Escape(hTitle)
+		hTitle = strings.ReplaceAll(hTitle, matchStart, fmt.Sprintf("[%s]", w.c.theme.Highlights))
+		hTitle = strings.ReplaceAll(hTitle, matchEnd, fmt.Sprintf("[%s]", w.c.theme.Title))
 		tc.SetText(hTitle)
+	} else if a.highlight {
+		tc.SetText(w.c.highlightTitle(a))
 	} else {
-		if a.highlight {
-			hTitle := ""
-			fields := strings.Fields(a.title)
-			for _, f := range fields {
-				found := false
-				for _, h := range w.c.conf.Highlights {
-					if strings.Contains(strings.ToLower(f), strings.ToLower(h)) {
-						found = true
-					}
-				}
-				if found {
-					hTitle += fmt.Sprintf("[%s]"+f+" [%s]", w.c.theme.Highlights, w.c.theme.Title)
-				} else {
-					hTitle += f + " "
-				}
-			}
-			tc.SetText(hTitle)
-		} else {
-			tc.SetText(a.title)
-		}
+		tc.SetText(a.title)
+	}
+	if len(a.tags) > 0 {
+		tc.SetText(tc.Text + w.tagsText(a))
 	}
 
 	str := time.Since(a.published).Round(time.Minute).String()
@@ -702,6 +1076,9 @@ func (w *Window) AddToArticles(a *Article, markedWeb bool) {
 	w.articles.SetCell(w.nArticles, 3, dc)
 
 	ncText := ""
+	if a.starred {
+		ncText += w.c.theme.StarredMarker
+	}
 	if markedWeb {
 		ncText += w.c.theme.LinkMarker
 	}
@@ -716,27 +1093,45 @@ func (w *Window) AddToArticles(a *Article, markedWeb bool) {
 
 // AddPreview shows an article in the preview window
 func (w *Window) AddPreview(a *Article) {
-	parsed, err := html2text.FromString(a.content, html2text.Options{PrettyTables: true})
+	content := a.content
+	if a.fullContent != "" {
+		content = a.fullContent
+	}
+	base, _ := url.Parse(a.link)
+	content, w.links = NumberLinks(content, base)
+	parsed, err := html2text.FromString(content, html2text.Options{PrettyTables: true, OmitLinks: true})
 	if err != nil {
 		log.Printf("Failed to parse html to text, rendering original.")
-		parsed = a.content
+		parsed = content
 	}
 
 	w.preview.Clear()
 
+	tags := ""
+	if len(a.tags) > 0 {
+		tags = fmt.Sprintf("\n[white]Tags:%s", w.tagsText(a))
+	}
+
 	text := fmt.Sprintf(
-		"[%s][%s][%s] %s [white]([%s]%s[white])\n\n[%s]%s\n\nLink: [%s]%s",
+		"[%s][%s][%s] %s [white]([%s]%s[white])%s\n\n[%s]%s\n\nLink: [%s]%s",
 		"white",
 		a.feed,
 		w.c.theme.Title,
 		a.title,
 		w.c.theme.Date,
 		a.published,
+		tags,
 		w.c.theme.PreviewText,
-		parsed,
+		tview.Escape(parsed),
 		w.c.theme.PreviewLink,
 		a.link,
 	)
+	if len(w.links) > 0 {
+		text += fmt.Sprintf("\n\n[%s]Links:", w.c.theme.PreviewText)
+		for i, l := range w.links {
+			text += fmt.Sprintf("\n[%s]%s", w.c.theme.PreviewLink, tview.Escape(fmt.Sprintf("[%d] %s", i+1, l)))
+		}
+	}
 	w.preview.SetText(text)
 	w.preview.ScrollToBeginning()
 }